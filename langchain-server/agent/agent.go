@@ -3,8 +3,10 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -22,42 +24,60 @@ import (
 )
 
 type LangChainAgent struct {
-	executor      *agents.Executor
-	llmClient     *llm.LangChainClient
-	tools         []tools.Tool
-	toolDefs      []types.Tool
-	mcpServers    []string
+	executor  *agents.Executor
+	llmClient *llm.LangChainClient
+	tools     []tools.Tool
+	toolDefs  []types.Tool
+	// toolRoutes routes each offered tool to the server that provides it
+	toolRoutes map[string]*mcp.MCPTool
+	// toolRetrieval narrows the offered tools per turn, see selectTools
+	toolRetrieval *types.ToolRetrieval
 	systemPrompt  *string
+	// jsonMode asks the provider for JSON output, see answerOptions
+	jsonMode      bool
 	supportsTools bool
 	provider      string
 }
 
 func CreateLangChainAgent(
 	requestID string,
+	ctx context.Context,
 	credential types.RequestChatCredential,
-	mcpServers []string,
+	discovery *mcp.Discovery,
+	toolFilter *types.ToolFilter,
+	toolRetrieval *types.ToolRetrieval,
 	systemPrompt *string,
+	responseFormat *types.ResponseFormat,
 ) (*LangChainAgent, error) {
 	utils.VerbosePrintf("\n[%s]📦 [AGENT] Creating LangChain Agent...\n", requestID)
 	utils.VerbosePrintf("[%s]   Provider: %s\n", requestID, credential.Provider)
 	if credential.Model != nil {
 		utils.VerbosePrintf("[%s]   Model: %s\n", requestID, *credential.Model)
 	}
-	utils.VerbosePrintf("[%s]   MCP Servers: %d\n", requestID, len(mcpServers))
+	utils.VerbosePrintf("[%s]   MCP Servers: %d\n", requestID, len(discovery.Servers))
 
-	langchainTools, toolDefs, err := mcp.LoadMCPToolsAsLangChain(requestID, mcpServers)
+	langchainTools, toolDefs, err := mcp.LoadMCPToolsAsLangChain(requestID, discovery, toolFilter)
 	if err != nil {
 		return nil, err
 	}
+	// The first server offering a name wins, as in the tool list
+	toolRoutes := map[string]*mcp.MCPTool{}
+	for _, tool := range langchainTools {
+		if mcpTool, ok := tool.(*mcp.MCPTool); ok {
+			if _, exists := toolRoutes[tool.Name()]; !exists {
+				toolRoutes[tool.Name()] = mcpTool
+			}
+		}
+	}
 	utils.VerbosePrintf("[%s]   ✅ Loaded %d tools from MCP servers\n", requestID, len(langchainTools))
 
-	llmClient, err := llm.CreateLangChainLLM(requestID, credential)
+	llmClient, err := llm.CreateLangChainLLM(requestID, ctx, credential)
 	if err != nil {
 		return nil, err
 	}
 
 	utils.VerbosePrintf("\n[%s]🤖 Using LLM provider: %s", requestID, credential.Provider)
-	if llmClient.SupportsTools {
+	if llmClient.Capabilities.NativeTools {
 		utils.VerbosePrintf(" (with native tool calling)\n")
 	} else {
 		utils.VerbosePrintf(" (with manual tool calling)\n")
@@ -67,24 +87,19 @@ func CreateLangChainAgent(
 		llmClient:     llmClient,
 		tools:         langchainTools,
 		toolDefs:      toolDefs,
-		mcpServers:    mcpServers,
-		systemPrompt:  systemPrompt,
-		supportsTools: llmClient.SupportsTools,
+		toolRoutes:    toolRoutes,
+		toolRetrieval: toolRetrieval,
+		systemPrompt:  StructuredPrompt(systemPrompt, responseFormat),
+		jsonMode:      responseFormat != nil && llmClient.Capabilities.JSONMode,
+		supportsTools: llmClient.Capabilities.NativeTools,
 		provider:      credential.Provider,
 	}
 
-	if llmClient.SupportsTools {
+	if llmClient.Capabilities.NativeTools {
 		utils.VerbosePrintf("[%s]   🔧 Initializing agent executor with native tool calling...\n", requestID)
-		executor, err := agents.Initialize(
-			llmClient.LLM,
-			langchainTools,
-			agents.ZeroShotReactDescription,
-			agents.WithMemory(memory.NewConversationBuffer()),
-		)
-		if err != nil {
+		if err := agent.initExecutor(requestID); err != nil {
 			return nil, err
 		}
-		agent.executor = executor
 		utils.VerbosePrintf("[%s]   ✅ Agent executor initialized\n", requestID)
 	} else {
 		utils.VerbosePrintf("[%s]   🔧 Using manual tool calling mode\n", requestID)
@@ -94,21 +109,39 @@ func CreateLangChainAgent(
 	return agent, nil
 }
 
-func (a *LangChainAgent) Invoke(requestID string, ctx context.Context, input string) (*types.AgentState, error) {
+// initExecutor builds the langchaingo executor over the offered tools.
+func (a *LangChainAgent) initExecutor(requestID string) error {
+	executor, err := agents.Initialize(
+		a.llmClient.ResilientLLM(requestID),
+		a.tools,
+		agents.ZeroShotReactDescription,
+		agents.WithMemory(memory.NewConversationBuffer()),
+	)
+	if err != nil {
+		return err
+	}
+	a.executor = executor
+	return nil
+}
+
+// Invoke runs the agent to a final answer. On failure the returned state
+// still holds the messages completed so far, so the tokens they spent can
+// be accounted for.
+func (a *LangChainAgent) Invoke(requestID string, ctx context.Context, input types.AgentInput) (*types.AgentState, error) {
 	utils.VerbosePrintf("\n[%s]🚀 [INVOKE] Starting agent invocation...\n", requestID)
-	utils.VerbosePrintf("[%s]   Input: %s\n", requestID, input)
+	utils.VerbosePrintf("[%s]   Input: %s (%d parts, %d history messages)\n", requestID, input.Text, len(input.Parts), len(input.History))
 
-	state := &types.AgentState{
-		Input:    input,
-		Messages: []types.Message{},
+	state := newAgentState(input)
+	if _, err := a.selectTools(requestID, ctx, state); err != nil {
+		return state, err
 	}
 
-	if a.supportsTools && a.executor != nil {
+	if a.useExecutor(state) {
 		utils.VerbosePrintf("[%s]   🔄 Using native tool calling executor...\n", requestID)
-		result, err := chains.Run(ctx, a.executor, input)
+		result, err := chains.Run(ctx, a.executor, state.Input)
 		if err != nil {
 			utils.VerbosePrintf("[%s]   ❌ Error: %v\n", requestID, err)
-			return nil, err
+			return state, err
 		}
 
 		utils.VerbosePrintf("[%s]   ✅ Response: %s\n", requestID, result)
@@ -133,10 +166,10 @@ func (a *LangChainAgent) Invoke(requestID string, ctx context.Context, input str
 		utils.VerbosePrintf("[%s]      📝 Built %d messages for LLM\n", requestID, len(messages))
 		utils.VerbosePrintf("[%s]      🤖 Calling LLM...\n", requestID)
 
-		content, llmResult, err := a.llmClient.GenerateContentWithMetadata(requestID, ctx, messages)
+		content, llmResult, err := a.llmClient.GenerateContentWithMetadata(requestID, ctx, messages, a.answerOptions()...)
 		if err != nil {
 			utils.VerbosePrintf("[%s]      ❌ LLM Error: %v\n", requestID, err)
-			return nil, err
+			return state, err
 		}
 		utils.VerbosePrintf("[%s]      ✅ LLM Response (%d chars)\n", requestID, len(content))
 		paramsJSON, _ := json.Marshal(llmResult)
@@ -148,140 +181,7 @@ func (a *LangChainAgent) Invoke(requestID string, ctx context.Context, input str
 			Content: content,
 		}
 
-		// Extract metadata from LLM result if available
-		if llmResult != nil && len(llmResult.Choices) > 0 {
-			utils.VerbosePrintf("[%s]      🔍 Extracting metadata from llmResult...\n", requestID)
-			// Extract usage metadata from GenerationInfo
-			if llmResult.Choices[0].GenerationInfo != nil {
-				genInfo := llmResult.Choices[0].GenerationInfo
-				genInfoJSON, _ := json.Marshal(genInfo)
-				utils.VerbosePrintf("[%s]         GenerationInfo: %s\n", requestID, string(genInfoJSON))
-				usageData := &types.UsageMetadata{}
-
-				// Extract basic token counts (handle both int and float64)
-				if val, ok := genInfo["PromptTokens"]; ok {
-					if intVal, ok := val.(int); ok {
-						usageData.InputTokens = intVal
-						utils.VerbosePrintf("[%s]         ✅ PromptTokens: %d\n", requestID, intVal)
-					} else if floatVal, ok := val.(float64); ok {
-						usageData.InputTokens = int(floatVal)
-						utils.VerbosePrintf("[%s]         ✅ PromptTokens: %d\n", requestID, int(floatVal))
-					} else {
-						utils.VerbosePrintf("[%s]         ❌ PromptTokens wrong type: %T\n", requestID, val)
-					}
-				}
-				if val, ok := genInfo["CompletionTokens"]; ok {
-					if intVal, ok := val.(int); ok {
-						usageData.OutputTokens = intVal
-						utils.VerbosePrintf("[%s]         ✅ CompletionTokens: %d\n", requestID, intVal)
-					} else if floatVal, ok := val.(float64); ok {
-						usageData.OutputTokens = int(floatVal)
-						utils.VerbosePrintf("[%s]         ✅ CompletionTokens: %d\n", requestID, int(floatVal))
-					} else {
-						utils.VerbosePrintf("[%s]         ❌ CompletionTokens wrong type: %T\n", requestID, val)
-					}
-				}
-				if val, ok := genInfo["TotalTokens"]; ok {
-					if intVal, ok := val.(int); ok {
-						usageData.TotalTokens = intVal
-						utils.VerbosePrintf("[%s]         ✅ TotalTokens: %d\n", requestID, intVal)
-					} else if floatVal, ok := val.(float64); ok {
-						usageData.TotalTokens = int(floatVal)
-						utils.VerbosePrintf("[%s]         ✅ TotalTokens: %d\n", requestID, int(floatVal))
-					} else {
-						utils.VerbosePrintf("[%s]         ❌ TotalTokens wrong type: %T\n", requestID, val)
-					}
-				}
-
-				// Extract additional token details (handle both int and float64)
-				if val, ok := genInfo["CompletionAcceptedPredictionTokens"]; ok {
-					if intVal, ok := val.(int); ok {
-						usageData.CompletionAcceptedPredictionTokens = intVal
-					} else if floatVal, ok := val.(float64); ok {
-						usageData.CompletionAcceptedPredictionTokens = int(floatVal)
-					}
-				}
-				if val, ok := genInfo["CompletionAudioTokens"]; ok {
-					if intVal, ok := val.(int); ok {
-						usageData.CompletionAudioTokens = intVal
-					} else if floatVal, ok := val.(float64); ok {
-						usageData.CompletionAudioTokens = int(floatVal)
-					}
-				}
-				if val, ok := genInfo["CompletionReasoningTokens"]; ok {
-					if intVal, ok := val.(int); ok {
-						usageData.CompletionReasoningTokens = intVal
-					} else if floatVal, ok := val.(float64); ok {
-						usageData.CompletionReasoningTokens = int(floatVal)
-					}
-				}
-				if val, ok := genInfo["CompletionRejectedPredictionTokens"]; ok {
-					if intVal, ok := val.(int); ok {
-						usageData.CompletionRejectedPredictionTokens = intVal
-					} else if floatVal, ok := val.(float64); ok {
-						usageData.CompletionRejectedPredictionTokens = int(floatVal)
-					}
-				}
-				if val, ok := genInfo["PromptAudioTokens"]; ok {
-					if intVal, ok := val.(int); ok {
-						usageData.PromptAudioTokens = intVal
-					} else if floatVal, ok := val.(float64); ok {
-						usageData.PromptAudioTokens = int(floatVal)
-					}
-				}
-				if val, ok := genInfo["PromptCachedTokens"]; ok {
-					if intVal, ok := val.(int); ok {
-						usageData.PromptCachedTokens = intVal
-					} else if floatVal, ok := val.(float64); ok {
-						usageData.PromptCachedTokens = int(floatVal)
-					}
-				}
-				if val, ok := genInfo["ReasoningTokens"]; ok {
-					if intVal, ok := val.(int); ok {
-						usageData.ReasoningTokens = intVal
-					} else if floatVal, ok := val.(float64); ok {
-						usageData.ReasoningTokens = int(floatVal)
-					}
-				}
-				if val, ok := genInfo["ThinkingTokens"]; ok {
-					if intVal, ok := val.(int); ok {
-						usageData.ThinkingTokens = intVal
-					} else if floatVal, ok := val.(float64); ok {
-						usageData.ThinkingTokens = int(floatVal)
-					}
-				}
-
-				// Set token details if available
-				if usageData.PromptCachedTokens > 0 || usageData.PromptAudioTokens > 0 {
-					usageData.InputTokenDetails = &types.InputTokenDetails{
-						Audio:     usageData.PromptAudioTokens,
-						CacheRead: usageData.PromptCachedTokens,
-					}
-				}
-				if usageData.CompletionAudioTokens > 0 || usageData.CompletionReasoningTokens > 0 {
-					usageData.OutputTokenDetails = &types.OutputTokenDetails{
-						Audio:     usageData.CompletionAudioTokens,
-						Reasoning: usageData.CompletionReasoningTokens,
-					}
-				}
-
-				response.UsageData = usageData
-				utils.VerbosePrintf("[%s]         📊 UsageData set: Input=%d, Output=%d, Total=%d\n",
-					requestID, usageData.InputTokens, usageData.OutputTokens, usageData.TotalTokens)
-			} else {
-				utils.VerbosePrintf("[%s]         ⚠️  GenerationInfo is nil\n", requestID)
-			}
-
-			// Extract finish reason
-			if llmResult.Choices[0].StopReason != "" {
-				if response.Metadata == nil {
-					response.Metadata = &types.ResponseMetadata{}
-				}
-				response.Metadata.FinishReason = llmResult.Choices[0].StopReason
-				response.Metadata.ModelProvider = a.provider
-				response.Metadata.ModelName = a.llmClient.Model
-			}
-		}
+		a.extractResponseMetadata(requestID, response, llmResult)
 
 		response = a.parseManualToolCalls(response)
 		state.Messages = append(state.Messages, *response)
@@ -302,7 +202,7 @@ func (a *LangChainAgent) Invoke(requestID string, ctx context.Context, input str
 		toolMessages, err := a.executeTools(requestID, ctx, response.ToolCalls)
 		if err != nil {
 			utils.VerbosePrintf("[%s]      ❌ Tool execution error: %v\n", requestID, err)
-			return nil, err
+			return state, err
 		}
 		utils.VerbosePrintf("[%s]      ✅ Tools executed successfully (%d results)\n", requestID, len(toolMessages))
 
@@ -313,26 +213,86 @@ func (a *LangChainAgent) Invoke(requestID string, ctx context.Context, input str
 	return state, nil
 }
 
-func (a *LangChainAgent) StreamInvoke(requestID string, ctx context.Context, input string, eventChan chan<- StreamEvent) error {
-	defer close(eventChan)
+// extractResponseMetadata copies token usage and finish reason from the LLM
+// result onto the assistant message.
+func (a *LangChainAgent) extractResponseMetadata(requestID string, response *types.Message, llmResult *llms.ContentResponse) {
+	// Extract metadata from LLM result if available
+	if llmResult != nil && len(llmResult.Choices) > 0 {
+		utils.VerbosePrintf("[%s]      🔍 Extracting metadata from llmResult...\n", requestID)
+		// With fallbacks configured another provider may have answered
+		provider, model := llm.AnsweredBy(llmResult, a.provider, a.llmClient.Model)
+		// Extract usage metadata from GenerationInfo
+		if llmResult.Choices[0].GenerationInfo != nil {
+			genInfo := llmResult.Choices[0].GenerationInfo
+			genInfoJSON, _ := json.Marshal(genInfo)
+			utils.VerbosePrintf("[%s]         GenerationInfo: %s\n", requestID, string(genInfoJSON))
+			if usageData := llm.NormalizeUsage(provider, genInfo); usageData != nil {
+				response.UsageData = usageData
+				utils.VerbosePrintf("[%s]         📊 UsageData set: Input=%d, Output=%d, Total=%d\n",
+					requestID, usageData.InputTokens, usageData.OutputTokens, usageData.TotalTokens)
+			} else {
+				utils.VerbosePrintf("[%s]         ⚠️  No token usage reported\n", requestID)
+			}
+		} else {
+			utils.VerbosePrintf("[%s]         ⚠️  GenerationInfo is nil\n", requestID)
+		}
 
-	state := &types.AgentState{
-		Input:    input,
-		Messages: []types.Message{},
+		// Extract finish reason
+		if llmResult.Choices[0].StopReason != "" {
+			if response.Metadata == nil {
+				response.Metadata = &types.ResponseMetadata{}
+			}
+			response.Metadata.FinishReason = llmResult.Choices[0].StopReason
+			response.Metadata.ModelProvider = provider
+			response.Metadata.ModelName = model
+			if genInfo := llmResult.Choices[0].GenerationInfo; genInfo != nil {
+				if attempts, ok := genInfo[llm.GenInfoAttempts].(int); ok {
+					response.Metadata.Attempts = attempts
+				}
+				if fallbackUsed, ok := genInfo[llm.GenInfoFallbackUsed].(bool); ok {
+					response.Metadata.FallbackUsed = fallbackUsed
+				}
+			}
+		}
 	}
+}
+
+// StreamInvoke runs the agent like Invoke, reporting progress on eventChan,
+// which it closes before returning.
+func (a *LangChainAgent) StreamInvoke(requestID string, ctx context.Context, input types.AgentInput, eventChan chan<- StreamEvent) (*types.AgentState, error) {
+	defer close(eventChan)
+	startTime := time.Now()
+
+	state := newAgentState(input)
 
 	eventChan <- StreamEvent{
 		Type:      "start",
 		Timestamp: time.Now().Format(time.RFC3339),
 		Data: map[string]interface{}{
-			"input": input,
+			"input": state.Input,
 		},
 	}
 
-	if a.supportsTools && a.executor != nil {
-		result, err := chains.Run(ctx, a.executor, input)
+	selection, err := a.selectTools(requestID, ctx, state)
+	if err != nil {
+		return state, err
+	}
+	if selection != nil {
+		eventChan <- StreamEvent{
+			Type:      "tools_selected",
+			Timestamp: time.Now().Format(time.RFC3339),
+			Data: map[string]interface{}{
+				"tools":       selection.Tools,
+				"method":      selection.Method,
+				"total_tools": selection.Total,
+			},
+		}
+	}
+
+	if a.useExecutor(state) {
+		result, err := chains.Run(ctx, a.executor, state.Input)
 		if err != nil {
-			return err
+			return state, err
 		}
 
 		eventChan <- StreamEvent{
@@ -344,15 +304,14 @@ func (a *LangChainAgent) StreamInvoke(requestID string, ctx context.Context, inp
 			},
 		}
 
-		eventChan <- StreamEvent{
-			Type: "done",
-			Data: map[string]interface{}{
-				"done":      true,
-				"timestamp": time.Now().Format(time.RFC3339),
-			},
-		}
+		state.Message = &result
+		state.Messages = append(state.Messages, types.Message{
+			Role:    "assistant",
+			Content: result,
+		})
+		eventChan <- a.doneEvent(state, startTime, 0)
 
-		return nil
+		return state, nil
 	}
 
 	maxIterations := 10
@@ -373,7 +332,7 @@ func (a *LangChainAgent) StreamInvoke(requestID string, ctx context.Context, inp
 		stepCount++
 
 		messages := a.buildMessages(requestID, state)
-		contentChan, errChan := a.llmClient.StreamGenerateContent(requestID, ctx, messages)
+		contentChan, resultChan, errChan := a.llmClient.StreamGenerateContent(requestID, ctx, messages, a.answerOptions()...)
 
 		accumulatedContent := ""
 		isInThinkingMode := false
@@ -514,17 +473,26 @@ func (a *LangChainAgent) StreamInvoke(requestID string, ctx context.Context, inp
 
 			case err := <-errChan:
 				if err != nil {
-					return err
+					return state, err
 				}
 			}
 		}
 
 	StreamDone:
+		// Both channels are closed by now; make sure an error that raced
+		// with the end of the content stream is not lost
+		if err := <-errChan; err != nil {
+			return state, err
+		}
+
 		response := &types.Message{
 			Role:    "assistant",
 			Content: accumulatedContent,
 		}
 
+		// The final response is delivered before the content channel closes
+		a.extractResponseMetadata(requestID, response, <-resultChan)
+
 		response = a.parseManualToolCalls(response)
 		state.Messages = append(state.Messages, *response)
 
@@ -577,19 +545,26 @@ func (a *LangChainAgent) StreamInvoke(requestID string, ctx context.Context, inp
 
 		toolMessages, err := a.executeTools(requestID, ctx, response.ToolCalls)
 		if err != nil {
-			return err
+			return state, err
 		}
 
 		for i, toolMsg := range toolMessages {
+			data := map[string]interface{}{
+				"node":        "tool_execution_end",
+				"step":        stepCount,
+				"tool_name":   response.ToolCalls[i].Name,
+				"tool_result": toolMsg.Content,
+				"timestamp":   time.Now().Format(time.RFC3339),
+			}
+			if len(toolMsg.Parts) > 0 {
+				data["tool_result_parts"] = toolMsg.Parts
+			}
+			if toolMsg.ToolMetadata != nil && toolMsg.ToolMetadata.CacheHit {
+				data["cache_hit"] = true
+			}
 			eventChan <- StreamEvent{
 				Type: "node_execution",
-				Data: map[string]interface{}{
-					"node":        "tool_execution_end",
-					"step":        stepCount,
-					"tool_name":   response.ToolCalls[i].Name,
-					"tool_result": toolMsg.Content,
-					"timestamp":   time.Now().Format(time.RFC3339),
-				},
+				Data: data,
 			}
 			stepCount++
 		}
@@ -597,16 +572,49 @@ func (a *LangChainAgent) StreamInvoke(requestID string, ctx context.Context, inp
 		state.Messages = append(state.Messages, toolMessages...)
 	}
 
-	eventChan <- StreamEvent{
-		Type: "done",
-		Data: map[string]interface{}{
-			"done":        true,
-			"total_steps": stepCount,
-			"timestamp":   time.Now().Format(time.RFC3339),
-		},
+	eventChan <- a.doneEvent(state, startTime, stepCount)
+
+	return state, nil
+}
+
+// doneEvent builds the final stream event carrying the same summary fields
+// as the non-streaming chat response.
+func (a *LangChainAgent) doneEvent(state *types.AgentState, startTime time.Time, stepCount int) StreamEvent {
+	executionTime := time.Since(startTime).Milliseconds()
+	executionTimeSec := float64(executionTime) / 1000.0
+	summary := Summarize(state.Messages)
+
+	provider, model := a.provider, a.llmClient.Model
+	if summary.LastMetadata != nil && summary.LastMetadata.ModelProvider != "" {
+		provider, model = summary.LastMetadata.ModelProvider, summary.LastMetadata.ModelName
 	}
 
-	return nil
+	data := map[string]interface{}{
+		"done":               true,
+		"total_steps":        stepCount,
+		"model_provider":     provider,
+		"model_name":         model,
+		"finish_reason":      summary.FinishReason,
+		"total_iterations":   summary.TotalIterations,
+		"tool_calls_count":   summary.ToolCallsCount,
+		"execution_time_ms":  executionTime,
+		"execution_time_sec": executionTimeSec,
+		"timestamp":          time.Now().Format(time.RFC3339),
+	}
+	if state.Message != nil {
+		data["message"] = *state.Message
+	}
+	if summary.UsageMetadata != nil {
+		data["usage_metadata"] = summary.UsageMetadata
+		if summary.UsageMetadata.TotalTokens > 0 && executionTimeSec > 0 {
+			data["tokens_per_second"] = float64(summary.UsageMetadata.TotalTokens) / executionTimeSec
+		}
+	}
+
+	return StreamEvent{
+		Type: "done",
+		Data: data,
+	}
 }
 
 func (a *LangChainAgent) buildMessages(requestID string, state *types.AgentState) []llms.MessageContent {
@@ -617,7 +625,9 @@ func (a *LangChainAgent) buildMessages(requestID string, state *types.AgentState
 		messages = append(messages, llms.TextParts(llms.ChatMessageTypeSystem, *a.systemPrompt))
 	}
 
-	if !a.supportsTools && len(state.Messages) == 0 {
+	// The manual loop relies on the ReAct prompt for tool calls, also for
+	// native tool providers whose turn could not go through the executor
+	if len(state.Messages) == 0 {
 		reactPrompt := a.buildReactPrompt()
 		messages = append(messages, llms.TextParts(llms.ChatMessageTypeSystem, reactPrompt))
 	}
@@ -629,13 +639,19 @@ func (a *LangChainAgent) buildMessages(requestID string, state *types.AgentState
 		maxHistoryMessages = *a.llmClient.Config.MaxContextMessages
 	}
 
+	conversation := append(append([]types.Message{}, state.History...), state.Messages...)
 	startIdx := 0
-	if len(state.Messages) > maxHistoryMessages {
-		startIdx = len(state.Messages) - maxHistoryMessages
-		utils.VerbosePrintf("[%s]      ⚠️  Trimming message history: keeping last %d of %d messages\n", requestID, maxHistoryMessages, len(state.Messages))
+	if len(conversation) > maxHistoryMessages {
+		startIdx = len(conversation) - maxHistoryMessages
+		utils.VerbosePrintf("[%s]      ⚠️  Trimming message history: keeping last %d of %d messages\n", requestID, maxHistoryMessages, len(conversation))
 	}
 
-	for _, msg := range state.Messages[startIdx:] {
+	for _, msg := range conversation[startIdx:] {
+		if msg.Role == "tool" {
+			messages = append(messages, a.toolResultMessages(msg)...)
+			continue
+		}
+
 		var msgType llms.ChatMessageType
 		switch msg.Role {
 		case "user":
@@ -650,10 +666,10 @@ func (a *LangChainAgent) buildMessages(requestID string, state *types.AgentState
 		default:
 			msgType = llms.ChatMessageTypeGeneric
 		}
-		messages = append(messages, llms.TextParts(msgType, msg.Content))
+		messages = append(messages, messageContent(msgType, msg.Content, msg.Parts))
 	}
 
-	messages = append(messages, llms.TextParts(llms.ChatMessageTypeHuman, state.Input))
+	messages = append(messages, messageContent(llms.ChatMessageTypeHuman, state.Input, state.InputParts))
 
 	return messages
 }
@@ -793,57 +809,99 @@ func (a *LangChainAgent) executeTools(requestID string, ctx context.Context, too
 
 	for idx, call := range toolCalls {
 		utils.VerbosePrintf("[%s]         [%d/%d] Executing: %s\n", requestID, idx+1, len(toolCalls), call.Name)
-		var result interface{}
-		var err error
-
-		for _, serverURL := range a.mcpServers {
-			result, err = mcp.InvokeTool(serverURL, call.Name, call.Args)
-			if err == nil {
-				utils.VerbosePrintf("[%s]            ✅ Success from %s\n", requestID, serverURL)
-				break
-			} else {
-				utils.VerbosePrintf("[%s]            ⚠️  Failed from %s: %v\n", requestID, serverURL, err)
-			}
+		tool, ok := a.toolRoutes[call.Name]
+		if !ok {
+			// Models name tools they were not offered; let them pick again
+			utils.VerbosePrintf("[%s]            ❌ Tool %s is not offered\n", requestID, call.Name)
+			toolMessages = append(toolMessages, types.Message{
+				Role:         "tool",
+				ToolCallID:   call.ID,
+				Name:         call.Name,
+				Content:      fmt.Sprintf("Tool '%s' FAILED with error: tool is not available, use one of: %s", call.Name, strings.Join(a.toolNames(), ", ")),
+				ToolMetadata: &types.ToolMetadata{},
+			})
+			continue
 		}
 
+		server := tool.Server()
+		result, hit, err := tool.Invoke(ctx, call.Args)
+		var circuitErr *mcp.CircuitOpenError
+		if errors.As(err, &circuitErr) {
+			// Tell the model instead of failing the request, so it can answer
+			// without the server or use another tool
+			utils.VerbosePrintf("[%s]            ⛔ %v\n", requestID, err)
+			toolMessages = append(toolMessages, types.Message{
+				Role:         "tool",
+				ToolCallID:   call.ID,
+				Name:         call.Name,
+				Content:      fmt.Sprintf("Tool '%s' FAILED with error: %v", call.Name, err),
+				ToolMetadata: &types.ToolMetadata{},
+			})
+			continue
+		}
 		if err != nil {
-			utils.VerbosePrintf("[%s]            ❌ All servers failed for %s\n", requestID, call.Name)
+			utils.VerbosePrintf("[%s]            ❌ Failed from %s: %v\n", requestID, server.URL, err)
 			return nil, err
 		}
-
-		resultJSON, _ := json.Marshal(result)
+		metadata := &types.ToolMetadata{}
+		if hit != nil {
+			metadata.CacheHit = true
+			metadata.CacheAgeMs = hit.Age.Milliseconds()
+			utils.VerbosePrintf("[%s]            ♻️  Cached result from %s (%dms old)\n", requestID, server.URL, metadata.CacheAgeMs)
+		} else {
+			utils.VerbosePrintf("[%s]            ✅ Success from %s\n", requestID, server.URL)
+		}
 
 		// Format tool result with clear context for LLM
 		var toolResultContent string
-		var resultData map[string]interface{}
-		if err := json.Unmarshal(resultJSON, &resultData); err == nil {
-			if resultMap, ok := resultData["result"].(map[string]interface{}); ok {
-				// Check if error exists
-				if errorMsg, hasError := resultMap["error"]; hasError {
-					toolResultContent = fmt.Sprintf("Tool '%s' FAILED with error: %v", call.Name, errorMsg)
+		var toolResultParts []types.ContentPart
+		if toolResult, ok := types.AsToolResult(result); ok {
+			toolResultContent, toolResultParts = formatToolResult(call.Name, toolResult)
+		} else {
+			resultJSON, _ := json.Marshal(result)
+
+			var resultData map[string]interface{}
+			if err := json.Unmarshal(resultJSON, &resultData); err == nil {
+				if resultMap, ok := resultData["result"].(map[string]interface{}); ok {
+					// Check if error exists
+					if errorMsg, hasError := resultMap["error"]; hasError {
+						toolResultContent = fmt.Sprintf("Tool '%s' FAILED with error: %v", call.Name, errorMsg)
+					} else {
+						// Success - format with clear context
+						resultStr, _ := json.Marshal(resultMap)
+						toolResultContent = fmt.Sprintf("Tool '%s' SUCCESS: %s", call.Name, string(resultStr))
+					}
 				} else {
-					// Success - format with clear context
-					resultStr, _ := json.Marshal(resultMap)
-					toolResultContent = fmt.Sprintf("Tool '%s' SUCCESS: %s", call.Name, string(resultStr))
+					toolResultContent = string(resultJSON)
 				}
 			} else {
 				toolResultContent = string(resultJSON)
 			}
-		} else {
-			toolResultContent = string(resultJSON)
 		}
 
 		toolMessages = append(toolMessages, types.Message{
-			Role:       "tool",
-			ToolCallID: call.ID,
-			Name:       call.Name,
-			Content:    toolResultContent,
+			Role:         "tool",
+			ToolCallID:   call.ID,
+			Name:         call.Name,
+			Content:      toolResultContent,
+			Parts:        toolResultParts,
+			ToolMetadata: metadata,
 		})
 	}
 
 	return toolMessages, nil
 }
 
+// toolNames lists the offered tools, sorted.
+func (a *LangChainAgent) toolNames() []string {
+	names := make([]string, 0, len(a.toolRoutes))
+	for name := range a.toolRoutes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 type StreamEvent struct {
 	Type      string                 `json:"type"`
 	Timestamp string                 `json:"timestamp,omitempty"`
@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"langchain-mcp-api/types"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+func newAgentState(input types.AgentInput) *types.AgentState {
+	return &types.AgentState{
+		Input:      input.Text,
+		InputParts: input.Parts,
+		History:    input.History,
+		Messages:   []types.Message{},
+	}
+}
+
+// useExecutor reports whether the langchaingo executor handles the turn. It
+// only accepts a single text input, so content parts and history go through
+// the manual loop.
+func (a *LangChainAgent) useExecutor(state *types.AgentState) bool {
+	return a.supportsTools && a.executor != nil && len(state.InputParts) == 0 && len(state.History) == 0
+}
+
+// messageContent builds an LLM message from either the content parts or,
+// when there are none, the plain text.
+func messageContent(role llms.ChatMessageType, text string, parts []types.ContentPart) llms.MessageContent {
+	if len(parts) == 0 {
+		return llms.TextParts(role, text)
+	}
+	return llms.MessageContent{Role: role, Parts: toLLMParts(parts)}
+}
+
+// toLLMParts maps request content parts to langchaingo parts. Images become
+// URL or binary parts; text files are inlined as text. Parts are validated
+// when the request is received.
+func toLLMParts(parts []types.ContentPart) []llms.ContentPart {
+	llmParts := make([]llms.ContentPart, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case types.ContentText:
+			llmParts = append(llmParts, llms.TextPart(part.Text))
+		case types.ContentImageURL:
+			llmParts = append(llmParts, llms.ImageURLPart(part.ImageURL))
+		case types.ContentImage:
+			data, _ := part.Decode()
+			llmParts = append(llmParts, llms.BinaryPart(part.MimeType, data))
+		case types.ContentFile:
+			data, _ := part.Decode()
+			name := part.Name
+			if name == "" {
+				name = "attachment"
+			}
+			llmParts = append(llmParts, llms.TextPart(fmt.Sprintf("Attached file %s (%s):\n%s", name, part.MimeType, data)))
+		}
+	}
+	return llmParts
+}
+
+// formatToolResult renders a tool result envelope as text for the LLM and
+// as content parts for API clients. Images are referenced in the text and
+// forwarded to vision models by toolResultMessages.
+func formatToolResult(toolName string, result *types.ToolResult) (string, []types.ContentPart) {
+	var lines []string
+	var parts []types.ContentPart
+	images := 0
+
+	for _, item := range result.Content {
+		switch item.Type {
+		case types.ToolContentText:
+			lines = append(lines, item.Text)
+			parts = append(parts, types.ContentPart{Type: types.ContentText, Text: item.Text})
+		case types.ToolContentImage:
+			images++
+			lines = append(lines, fmt.Sprintf("[image %d: %s]", images, item.MimeType))
+			parts = append(parts, types.ContentPart{Type: types.ContentImage, Data: item.Data, MimeType: item.MimeType})
+		case types.ToolContentResourceLink:
+			link := item.URI
+			if item.Name != "" {
+				link = fmt.Sprintf("%s <%s>", item.Name, item.URI)
+			}
+			if item.Description != "" {
+				link += " - " + item.Description
+			}
+			lines = append(lines, "[resource: "+link+"]")
+			parts = append(parts, types.ContentPart{Type: types.ContentResourceLink, URI: item.URI, Name: item.Name, MimeType: item.MimeType, Text: item.Description})
+		}
+	}
+
+	text := strings.Join(lines, "\n")
+	if result.IsError {
+		return fmt.Sprintf("Tool '%s' FAILED with error: %s", toolName, text), parts
+	}
+	return fmt.Sprintf("Tool '%s' SUCCESS: %s", toolName, text), parts
+}
+
+// toolResultMessages renders a tool message for the LLM. Tool and generic
+// roles cannot carry images on most providers, so images returned by the
+// tool follow as a user message when the model supports vision.
+func (a *LangChainAgent) toolResultMessages(msg types.Message) []llms.MessageContent {
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeGeneric, msg.Content)}
+
+	var images []types.ContentPart
+	for _, part := range msg.Parts {
+		if part.IsImage() {
+			images = append(images, part)
+		}
+	}
+	if len(images) == 0 || !a.llmClient.Capabilities.Vision {
+		return messages
+	}
+
+	parts := []llms.ContentPart{llms.TextPart(fmt.Sprintf("Images returned by tool '%s':", msg.Name))}
+	parts = append(parts, toLLMParts(images)...)
+	return append(messages, llms.MessageContent{Role: llms.ChatMessageTypeHuman, Parts: parts})
+}
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"langchain-mcp-api/mcp"
+	"langchain-mcp-api/retrieval"
+	"langchain-mcp-api/types"
+	"langchain-mcp-api/utils"
+
+	"github.com/tmc/langchaingo/tools"
+)
+
+// ToolSelection reports the tools offered for a turn by tool retrieval.
+type ToolSelection struct {
+	Tools  []string
+	Method string
+	Total  int
+}
+
+// selectTools narrows the offered tools to the top_k most relevant to the
+// input when tool retrieval is on and there are more tools than that. The
+// ReAct prompt, the executor and tool calls then only see the selection.
+func (a *LangChainAgent) selectTools(requestID string, ctx context.Context, state *types.AgentState) (*ToolSelection, error) {
+	if a.toolRetrieval == nil || len(a.toolDefs) <= a.toolRetrieval.TopK {
+		return nil, nil
+	}
+
+	query := state.Input
+	if query == "" {
+		query = types.PartsText(state.InputParts)
+	}
+
+	selected, method, err := retrieval.Select(ctx, query, a.toolDefs, a.toolRetrieval.TopK, a.toolRetrieval.Method)
+	if err != nil && a.toolRetrieval.Method == retrieval.MethodEmbedding {
+		return nil, types.NewErrorRequest(fmt.Sprintf("Embedding tool retrieval failed: %v", err), 502)
+	}
+	if err != nil {
+		utils.VerbosePrintf("[%s]   ⚠️  Embedding tool retrieval failed, used %s: %v\n", requestID, method, err)
+	}
+
+	selection := &ToolSelection{Method: method, Total: len(a.toolDefs)}
+	names := map[string]bool{}
+	for _, tool := range selected {
+		names[tool.Name] = true
+		selection.Tools = append(selection.Tools, tool.Name)
+	}
+
+	var offered []tools.Tool
+	for _, tool := range a.tools {
+		if names[tool.Name()] {
+			offered = append(offered, tool)
+		}
+	}
+	// Calls are only routed to the selection, so the model cannot run a
+	// tool it was not offered
+	routes := map[string]*mcp.MCPTool{}
+	for name, tool := range a.toolRoutes {
+		if names[name] {
+			routes[name] = tool
+		}
+	}
+	a.tools = offered
+	a.toolDefs = selected
+	a.toolRoutes = routes
+	utils.VerbosePrintf("[%s]   🔎 Offering %d of %d tools (%s): %v\n", requestID, len(selected), selection.Total, method, selection.Tools)
+
+	if a.executor != nil {
+		if err := a.initExecutor(requestID); err != nil {
+			return nil, err
+		}
+	}
+	return selection, nil
+}
@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"langchain-mcp-api/schema"
+	"langchain-mcp-api/types"
+	"langchain-mcp-api/utils"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// maxStructuredRepairs bounds the LLM calls spent turning a final answer
+// into JSON that validates against the requested schema.
+const maxStructuredRepairs = 2
+
+// StructuredResult is the final answer parsed against response_format.
+type StructuredResult struct {
+	Value   any
+	Repairs int
+	Usage   *types.UsageMetadata
+}
+
+// StructuredPrompt appends the response_format instructions to the system
+// prompt so the final answer is JSON from the start where possible.
+func StructuredPrompt(systemPrompt *string, format *types.ResponseFormat) *string {
+	if format == nil {
+		return systemPrompt
+	}
+
+	schemaJSON, _ := json.Marshal(format.Schema)
+	instruction := fmt.Sprintf("When you give your final answer, reply with a single JSON object that matches this JSON Schema and nothing else:\n%s", schemaJSON)
+	if systemPrompt != nil && *systemPrompt != "" {
+		instruction = *systemPrompt + "\n\n" + instruction
+	}
+	return &instruction
+}
+
+// answerOptions are the call options of the manual loop. With a
+// response_format they turn on JSON mode where the provider supports it, so
+// the first answer is already JSON; the manual tool calls are JSON objects
+// too. The executor's ReAct format is plain text and is left alone.
+func (a *LangChainAgent) answerOptions() []llms.CallOption {
+	if !a.jsonMode {
+		return nil
+	}
+	return []llms.CallOption{llms.WithJSONMode()}
+}
+
+// StructuredAnswer parses the final answer as JSON and validates it against
+// the schema. When that fails the LLM is asked to rewrite the answer, in
+// JSON mode when the provider supports it, feeding back the validation
+// errors each time.
+func (a *LangChainAgent) StructuredAnswer(requestID string, ctx context.Context, answer string, format *types.ResponseFormat) (*StructuredResult, error) {
+	utils.VerbosePrintf("\n[%s]🧩 [STRUCTURED] Validating final answer against response_format...\n", requestID)
+	result := &StructuredResult{}
+
+	candidate := answer
+	for {
+		value, errs := parseStructured(candidate, format.Schema)
+		if len(errs) == 0 {
+			utils.VerbosePrintf("[%s]   ✅ Final answer is valid (%d repair(s))\n", requestID, result.Repairs)
+			result.Value = value
+			return result, nil
+		}
+		utils.VerbosePrintf("[%s]   ⚠️  Invalid structured answer: %s\n", requestID, strings.Join(errs, "; "))
+
+		if result.Repairs >= maxStructuredRepairs {
+			return result, types.NewErrorRequest(fmt.Sprintf("Final answer does not match response_format: %s", strings.Join(errs, "; ")), 422)
+		}
+		result.Repairs++
+
+		repaired, usageData, err := a.repairStructured(requestID, ctx, answer, candidate, errs, format)
+		if err != nil {
+			return result, err
+		}
+		result.Usage = MergeUsage(result.Usage, usageData)
+		candidate = repaired
+	}
+}
+
+func (a *LangChainAgent) repairStructured(requestID string, ctx context.Context, answer, candidate string, errs []string, format *types.ResponseFormat) (string, *types.UsageMetadata, error) {
+	schemaJSON, _ := json.MarshalIndent(format.Schema, "", "  ")
+
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "JSON Schema:\n%s\n\nAnswer:\n%s\n", schemaJSON, answer)
+	if candidate != answer {
+		fmt.Fprintf(&prompt, "\nPrevious attempt:\n%s\n", candidate)
+	}
+	fmt.Fprintf(&prompt, "\nValidation errors:\n- %s\n", strings.Join(errs, "\n- "))
+
+	messages := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "You convert answers into JSON. Reply with a single JSON object that matches the given JSON Schema, using only information from the answer. Do not add explanations or code fences."),
+		llms.TextParts(llms.ChatMessageTypeHuman, prompt.String()),
+	}
+
+	var options []llms.CallOption
+	if a.llmClient.Capabilities.JSONMode {
+		options = append(options, llms.WithJSONMode())
+	}
+
+	utils.VerbosePrintf("[%s]   🔧 Asking LLM to repair structured answer (JSON mode: %v)...\n", requestID, a.llmClient.Capabilities.JSONMode)
+	content, llmResult, err := a.llmClient.GenerateContentWithMetadata(requestID, ctx, messages, options...)
+	if err != nil {
+		return "", nil, err
+	}
+
+	response := &types.Message{Role: "assistant", Content: content}
+	a.extractResponseMetadata(requestID, response, llmResult)
+	return content, response.UsageData, nil
+}
+
+// parseStructured extracts the JSON object from an answer, tolerating code
+// fences and surrounding prose, and validates it.
+func parseStructured(answer string, jsonSchema map[string]any) (any, []string) {
+	text := strings.TrimSpace(answer)
+	if start := strings.Index(text, "```"); start >= 0 {
+		fenced := text[start+3:]
+		fenced = strings.TrimPrefix(fenced, "json")
+		if end := strings.Index(fenced, "```"); end >= 0 {
+			text = strings.TrimSpace(fenced[:end])
+		}
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		start := strings.IndexAny(text, "{[")
+		end := strings.LastIndexAny(text, "}]")
+		if start < 0 || end <= start {
+			return nil, []string{"answer is not JSON"}
+		}
+		if err := json.Unmarshal([]byte(text[start:end+1]), &value); err != nil {
+			return nil, []string{fmt.Sprintf("answer is not valid JSON: %v", err)}
+		}
+	}
+
+	return value, schema.Validate(jsonSchema, value)
+}
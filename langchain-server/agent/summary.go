@@ -0,0 +1,90 @@
+package agent
+
+import "langchain-mcp-api/types"
+
+// Summary holds the per-request totals derived from the assistant messages
+// of an agent run.
+type Summary struct {
+	UsageMetadata   *types.UsageMetadata
+	LastMetadata    *types.ResponseMetadata
+	FinishReason    string
+	TotalIterations int
+	ToolCallsCount  int
+}
+
+// Summarize counts iterations and tool calls and accumulates token usage
+// over all assistant messages.
+func Summarize(messages []types.Message) Summary {
+	var summary Summary
+	usage := &types.UsageMetadata{}
+
+	for _, msg := range messages {
+		if msg.Role != "assistant" {
+			continue
+		}
+		summary.TotalIterations++
+		summary.ToolCallsCount += len(msg.ToolCalls)
+
+		// Accumulate token usage from each assistant message
+		addUsage(usage, msg.UsageData)
+
+		// Keep last metadata
+		if msg.Metadata != nil {
+			summary.LastMetadata = msg.Metadata
+			summary.FinishReason = msg.Metadata.FinishReason
+		}
+	}
+
+	if usage.TotalTokens > 0 {
+		setUsageDetails(usage)
+		summary.UsageMetadata = usage
+	}
+
+	return summary
+}
+
+// MergeUsage returns the sum of two usage blocks, either of which may be nil.
+func MergeUsage(a, b *types.UsageMetadata) *types.UsageMetadata {
+	if a == nil && b == nil {
+		return nil
+	}
+	usage := &types.UsageMetadata{}
+	addUsage(usage, a)
+	addUsage(usage, b)
+	setUsageDetails(usage)
+	return usage
+}
+
+func addUsage(total, usage *types.UsageMetadata) {
+	if usage == nil {
+		return
+	}
+	total.InputTokens += usage.InputTokens
+	total.OutputTokens += usage.OutputTokens
+	total.TotalTokens += usage.TotalTokens
+	total.PromptCachedTokens += usage.PromptCachedTokens
+	total.PromptAudioTokens += usage.PromptAudioTokens
+	total.CompletionAudioTokens += usage.CompletionAudioTokens
+	total.CompletionReasoningTokens += usage.CompletionReasoningTokens
+	total.ReasoningTokens += usage.ReasoningTokens
+	total.ThinkingTokens += usage.ThinkingTokens
+	total.CompletionAcceptedPredictionTokens += usage.CompletionAcceptedPredictionTokens
+	total.CompletionRejectedPredictionTokens += usage.CompletionRejectedPredictionTokens
+}
+
+// setUsageDetails fills the input and output detail blocks from the flat
+// counters.
+func setUsageDetails(usage *types.UsageMetadata) {
+	if usage.PromptCachedTokens > 0 || usage.PromptAudioTokens > 0 {
+		usage.InputTokenDetails = &types.InputTokenDetails{
+			Audio:     usage.PromptAudioTokens,
+			CacheRead: usage.PromptCachedTokens,
+		}
+	}
+	if usage.CompletionAudioTokens > 0 || usage.CompletionReasoningTokens > 0 {
+		usage.OutputTokenDetails = &types.OutputTokenDetails{
+			Audio:     usage.CompletionAudioTokens,
+			Reasoning: usage.CompletionReasoningTokens,
+		}
+	}
+}
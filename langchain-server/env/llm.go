@@ -0,0 +1,26 @@
+package env
+
+import (
+	"os"
+	"strings"
+)
+
+// VertexAllowADC lets vertex requests without a service account key use the
+// server's application default credentials. Off by default, as any caller
+// could otherwise bill the server's project.
+var VertexAllowADC bool
+
+// BedrockAllowAmbientCredentials lets bedrock requests sign with the AWS
+// credentials of the server (environment, shared config or instance role).
+// Requests carry no AWS credentials, so bedrock is unavailable without it.
+var BedrockAllowAmbientCredentials bool
+
+func init() {
+	VertexAllowADC = flag("VERTEX_ALLOW_ADC")
+	BedrockAllowAmbientCredentials = flag("BEDROCK_ALLOW_AMBIENT_CREDENTIALS")
+}
+
+func flag(key string) bool {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(key)))
+	return value == "true" || value == "1"
+}
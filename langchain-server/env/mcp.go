@@ -0,0 +1,130 @@
+package env
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MCPTimeout is the default timeout for tool listing and invocation calls to
+// MCP servers, MCPHealthTimeout the one for health checks. Both can be
+// overridden per server in the request.
+var MCPTimeout time.Duration
+var MCPHealthTimeout time.Duration
+
+// MCPDiscoveryTimeout is the shared deadline for checking every server of a
+// request and listing their tools, which run concurrently.
+var MCPDiscoveryTimeout time.Duration
+
+// MCPToolsTTL is how long a server's tool list is served from the
+// process-wide cache before it is refreshed in the background. 0 disables
+// the cache.
+var MCPToolsTTL time.Duration
+
+// MCPToolResultCacheSize is how many results of cacheable tools are kept in
+// the process-wide LRU cache. 0 disables result caching.
+var MCPToolResultCacheSize int
+
+// MCPServerCacheSize bounds each per-server table (tool lists, sessions,
+// OAuth token sources, health), evicting the least recently used server
+// beyond it. MCPServerIdleTTL drops entries of servers not used for that
+// long. Clients can name any number of servers, so neither is unbounded.
+var MCPServerCacheSize int
+var MCPServerIdleTTL time.Duration
+
+// MCPBreakerFailures is how many consecutive failed or slow calls open a
+// server's circuit breaker. 0 disables the breakers.
+var MCPBreakerFailures int
+
+// MCPBreakerCooldown is how long an open circuit rejects calls before a
+// probe is let through.
+var MCPBreakerCooldown time.Duration
+
+// MCPBreakerSlowCall is the latency above which a call counts as a failure
+// for the breaker, even when it succeeds.
+var MCPBreakerSlowCall time.Duration
+
+// MCPSecrets holds the MCP_SECRET_<NAME> variables by upper-case name.
+// Servers reference them by name so requests never carry the secret itself.
+var MCPSecrets map[string]string
+
+// MCPStdioConfig is an optional JSON file declaring MCP servers that are
+// launched as subprocesses, see mcp.StdioServerConfig.
+var MCPStdioConfig string
+
+// MCPServersConfig is an optional JSON file of named MCP servers that
+// requests reference by alias or tag, see mcp.ResolveServers.
+var MCPServersConfig string
+
+// MCPAdminToken guards the server registry admin API. Without it the API is
+// disabled.
+var MCPAdminToken string
+
+// MCPURLSchemes, MCPURLAllowedHosts and MCPURLAllowedCIDRs form the policy
+// for server URLs supplied by clients, see mcp.CheckURL. Hosts may be globs.
+// Private networks are only reachable through the allowed hosts and CIDRs.
+var MCPURLSchemes []string
+var MCPURLAllowedHosts []string
+var MCPURLAllowedCIDRs []string
+
+func init() {
+	MCPTimeout = durationMs("MCP_TIMEOUT_MS", 30*time.Second)
+	MCPHealthTimeout = durationMs("MCP_HEALTH_TIMEOUT_MS", 5*time.Second)
+	MCPDiscoveryTimeout = durationMs("MCP_DISCOVERY_TIMEOUT_MS", 10*time.Second)
+	MCPToolsTTL = durationMs("MCP_TOOLS_TTL_MS", 5*time.Minute)
+	if strings.TrimSpace(os.Getenv("MCP_TOOLS_TTL_MS")) == "0" {
+		MCPToolsTTL = 0
+	}
+	MCPToolResultCacheSize = 1000
+	if size, err := strconv.Atoi(strings.TrimSpace(os.Getenv("MCP_TOOL_RESULT_CACHE_SIZE"))); err == nil && size >= 0 {
+		MCPToolResultCacheSize = size
+	}
+	MCPServerCacheSize = 1000
+	if size, err := strconv.Atoi(strings.TrimSpace(os.Getenv("MCP_SERVER_CACHE_SIZE"))); err == nil && size > 0 {
+		MCPServerCacheSize = size
+	}
+	MCPServerIdleTTL = durationMs("MCP_SERVER_IDLE_TTL_MS", time.Hour)
+	MCPBreakerFailures = 5
+	if failures, err := strconv.Atoi(strings.TrimSpace(os.Getenv("MCP_BREAKER_FAILURES"))); err == nil && failures >= 0 {
+		MCPBreakerFailures = failures
+	}
+	MCPBreakerCooldown = durationMs("MCP_BREAKER_COOLDOWN_MS", 30*time.Second)
+	MCPBreakerSlowCall = durationMs("MCP_BREAKER_SLOW_CALL_MS", 10*time.Second)
+	MCPStdioConfig = strings.TrimSpace(os.Getenv("MCP_STDIO_CONFIG"))
+	MCPServersConfig = strings.TrimSpace(os.Getenv("MCP_SERVERS_CONFIG"))
+	MCPAdminToken = strings.TrimSpace(os.Getenv("MCP_ADMIN_TOKEN"))
+
+	MCPURLSchemes = list("MCP_URL_SCHEMES")
+	if len(MCPURLSchemes) == 0 {
+		MCPURLSchemes = []string{"http", "https"}
+	}
+	MCPURLAllowedHosts = list("MCP_URL_ALLOWED_HOSTS")
+	MCPURLAllowedCIDRs = list("MCP_URL_ALLOWED_CIDRS")
+
+	MCPSecrets = map[string]string{}
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		if name, ok := strings.CutPrefix(key, "MCP_SECRET_"); ok && name != "" && value != "" {
+			MCPSecrets[strings.ToUpper(name)] = value
+		}
+	}
+}
+
+// list reads a comma-separated variable, skipping empty items.
+func list(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, strings.ToLower(item))
+		}
+	}
+	return items
+}
+
+func durationMs(key string, fallback time.Duration) time.Duration {
+	if ms, err := strconv.Atoi(os.Getenv(key)); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return fallback
+}
@@ -0,0 +1,14 @@
+package env
+
+import (
+	"os"
+	"strings"
+)
+
+// PricingFile is an optional JSON price table that overrides the built-in
+// prices, see pricing.Table.
+var PricingFile string
+
+func init() {
+	PricingFile = strings.TrimSpace(os.Getenv("PRICING_FILE"))
+}
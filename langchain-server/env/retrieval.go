@@ -0,0 +1,29 @@
+package env
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ToolEmbeddingURL is the Ollama server used to embed tool descriptions for
+// tool retrieval, ToolEmbeddingModel its embedding model. Without a URL tool
+// retrieval ranks with BM25 only.
+var ToolEmbeddingURL string
+var ToolEmbeddingModel string
+
+// ToolEmbeddingCacheSize is how many tool description embeddings are kept,
+// least recently used first out.
+var ToolEmbeddingCacheSize int
+
+func init() {
+	ToolEmbeddingURL = strings.TrimSpace(os.Getenv("TOOL_EMBEDDING_URL"))
+	ToolEmbeddingModel = strings.TrimSpace(os.Getenv("TOOL_EMBEDDING_MODEL"))
+	if ToolEmbeddingModel == "" {
+		ToolEmbeddingModel = "nomic-embed-text"
+	}
+	ToolEmbeddingCacheSize = 10000
+	if size, err := strconv.Atoi(strings.TrimSpace(os.Getenv("TOOL_EMBEDDING_CACHE_SIZE"))); err == nil && size > 0 {
+		ToolEmbeddingCacheSize = size
+	}
+}
@@ -0,0 +1,17 @@
+package env
+
+import (
+	"os"
+	"strings"
+)
+
+// UsageLedgerPath is the JSONL file every request's usage is appended to.
+// Set USAGE_LEDGER_PATH to "off" to disable the ledger.
+var UsageLedgerPath string
+
+func init() {
+	UsageLedgerPath = strings.TrimSpace(os.Getenv("USAGE_LEDGER_PATH"))
+	if UsageLedgerPath == "" {
+		UsageLedgerPath = "usage.jsonl"
+	}
+}
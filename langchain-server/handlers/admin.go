@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"langchain-mcp-api/env"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// isAdmin reports whether the request carries the admin token as a bearer
+// token.
+func isAdmin(c fiber.Ctx) bool {
+	if env.MCPAdminToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(env.MCPAdminToken)) == 1
+}
+
+// requireAdmin answers requests without the admin token; ok reports
+// whether the handler may go on.
+func requireAdmin(c fiber.Ctx) (ok bool, err error) {
+	if env.MCPAdminToken == "" {
+		return false, c.Status(403).JSON(fiber.Map{
+			"error": "Admin API is disabled",
+		})
+	}
+	if !isAdmin(c) {
+		return false, c.Status(401).JSON(fiber.Map{
+			"error": "Invalid admin token",
+		})
+	}
+	return true, nil
+}
@@ -1,13 +1,18 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
 
 	"langchain-mcp-api/agent"
+	"langchain-mcp-api/llm"
 	"langchain-mcp-api/mcp"
+	"langchain-mcp-api/pricing"
+	"langchain-mcp-api/retrieval"
 	"langchain-mcp-api/types"
+	"langchain-mcp-api/usage"
 	"langchain-mcp-api/utils"
 
 	"github.com/gofiber/fiber/v3"
@@ -19,23 +24,197 @@ func validateChatRequest(body *types.RequestChatBody) error {
 		return types.NewErrorRequest("Missing provider", 400)
 	}
 
-	apiKeyProviders := []string{"openai", "claude", "openrouter"}
-	if utils.Contains(apiKeyProviders, body.Credential.Provider) && body.Credential.APIKey == nil {
-		return types.NewErrorRequest("Missing api key", 401)
+	if provider, ok := llm.GetProvider(body.Credential.Provider); ok {
+		if provider.RequiresAPIKey && body.Credential.APIKey == nil {
+			return types.NewErrorRequest("Missing api key", 401)
+		}
+		if provider.RequiresURL && body.Credential.URL == nil {
+			return types.NewErrorRequest("Missing url", 401)
+		}
+		if provider.RequiresProject && body.Credential.Project == nil {
+			return types.NewErrorRequest("Missing project", 400)
+		}
+	}
+
+	if set := body.Credential.Set; set != nil && set.ToolCalling != nil {
+		modes := []string{llm.ToolCallingAuto, llm.ToolCallingNative, llm.ToolCallingManual}
+		if !utils.Contains(modes, *set.ToolCalling) {
+			return types.NewErrorRequest("Invalid tool_calling, expected auto, native or manual", 400)
+		}
+	}
+
+	servers, err := resolveServers(body.Servers)
+	if err != nil {
+		return err
+	}
+	body.Servers = servers
+
+	if err := body.Tools.Validate(); err != nil {
+		return types.NewErrorRequest(fmt.Sprintf("Invalid tools filter: %v", err), 400)
+	}
+
+	if r := body.ToolRetrieval; r != nil {
+		if r.TopK < 1 {
+			return types.NewErrorRequest("tool_retrieval.top_k must be at least 1", 400)
+		}
+		switch r.Method {
+		case "", retrieval.MethodAuto, retrieval.MethodBM25:
+		case retrieval.MethodEmbedding:
+			if !retrieval.HasEmbedder() {
+				return types.NewErrorRequest("Embedding tool retrieval is not configured", 400)
+			}
+		default:
+			return types.NewErrorRequest("Invalid tool_retrieval.method, expected auto, embedding or bm25", 400)
+		}
+	}
+
+	if err := validateServerContext(body); err != nil {
+		return err
 	}
 
-	urlProviders := []string{"ollama", "llama_cpp", "vllm"}
-	if utils.Contains(urlProviders, body.Credential.Provider) && body.Credential.URL == nil {
-		return types.NewErrorRequest("Missing url", 401)
+	if body.ResponseFormat != nil && body.ResponseFormat.Schema == nil {
+		return types.NewErrorRequest("Missing response_format schema", 400)
 	}
 
-	if body.Input == "" {
+	// A prompt without input supplies the user turn itself
+	startsFromPrompt := body.Prompt != nil && len(body.History) == 0
+	if body.Input == "" && len(body.InputParts) == 0 && !startsFromPrompt {
 		return types.NewErrorRequest("Missing body request", 400)
 	}
 
+	if err := validateContent(body); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// resolveServers replaces registry references by the registered servers and
+// validates the result.
+func resolveServers(servers []types.MCPServer) ([]types.MCPServer, error) {
+	resolved, err := mcp.ResolveServers(servers)
+	if err != nil {
+		return nil, types.NewErrorRequest(fmt.Sprintf("Invalid servers: %v", err), 400)
+	}
+	for _, server := range resolved {
+		if err := mcp.ValidateServer(server); err != nil {
+			return nil, types.NewErrorRequest(fmt.Sprintf("Invalid server %s: %v", server.Name(), err), 400)
+		}
+	}
+	return resolved, nil
+}
+
+// validateServerContext checks that resources and the prompt refer to
+// servers of the request that support them.
+func validateServerContext(body *types.RequestChatBody) error {
+	checkServer := func(name string) error {
+		for _, server := range body.Servers {
+			if server.Name() != name {
+				continue
+			}
+			if server.Transport == "" || server.Transport == types.TransportREST {
+				return types.NewErrorRequest(fmt.Sprintf("Server %s uses the rest transport, which has no resources or prompts", name), 400)
+			}
+			return nil
+		}
+		return types.NewErrorRequest(fmt.Sprintf("Server %s is not in servers", name), 400)
+	}
+
+	for _, ref := range body.Resources {
+		if ref.URI == "" {
+			return types.NewErrorRequest("Missing resource uri", 400)
+		}
+		if err := checkServer(ref.Server); err != nil {
+			return err
+		}
+	}
+
+	if body.Prompt != nil {
+		if body.Prompt.Name == "" {
+			return types.NewErrorRequest("Missing prompt name", 400)
+		}
+		if err := checkServer(body.Prompt.Server); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyServerContext expands the requested prompt and reads the attached
+// resources into the conversation. Prompt messages come before the history;
+// when the request has no input, the prompt's final user message is the
+// input. Resources are placed ahead of the input parts.
+func applyServerContext(requestID string, ctx context.Context, body *types.RequestChatBody, servers []types.MCPServer) error {
+	if body.Prompt != nil {
+		messages, err := mcp.GetPrompt(requestID, ctx, servers, *body.Prompt)
+		if err != nil {
+			return types.NewErrorRequest(err.Error(), 502)
+		}
+
+		if body.Input == "" && len(body.InputParts) == 0 {
+			last := len(messages) - 1
+			if last < 0 || messages[last].Role != "user" {
+				return types.NewErrorRequest(fmt.Sprintf("Prompt %s does not end with a user message", body.Prompt.Name), 422)
+			}
+			body.Input = messages[last].Content
+			body.InputParts = messages[last].Parts
+			messages = messages[:last]
+		}
+		body.History = append(messages, body.History...)
+	}
+
+	if len(body.Resources) > 0 {
+		parts, err := mcp.ReadResources(requestID, ctx, servers, body.Resources)
+		if err != nil {
+			return types.NewErrorRequest(err.Error(), 502)
+		}
+
+		inputParts := body.InputParts
+		if len(inputParts) == 0 && body.Input != "" {
+			inputParts = []types.ContentPart{{Type: types.ContentText, Text: body.Input}}
+		}
+		body.InputParts = append(parts, inputParts...)
+	}
+
+	// Resources and prompts may carry images
+	return validateContent(body)
+}
+
+// validateContent checks the content parts of the input and history, and
+// that images are only sent to providers with vision support.
+func validateContent(body *types.RequestChatBody) error {
+	parts := append([]types.ContentPart{}, body.InputParts...)
+	for _, msg := range body.History {
+		switch msg.Role {
+		case "user", "assistant", "system":
+		default:
+			return types.NewErrorRequest(fmt.Sprintf("Invalid history role %q, expected user, assistant or system", msg.Role), 400)
+		}
+		parts = append(parts, msg.Parts...)
+	}
+
+	for _, part := range parts {
+		if err := part.Validate(); err != nil {
+			return types.NewErrorRequest(fmt.Sprintf("Invalid content part: %v", err), 400)
+		}
+	}
+
+	if types.HasImages(parts) {
+		if provider, ok := llm.GetProvider(body.Credential.Provider); ok && !provider.Capabilities.Vision {
+			return types.NewErrorRequest(fmt.Sprintf("Provider %s does not support image input", provider.Name), 400)
+		}
+	}
+	return nil
+}
+
+// resolveModelName returns the requested model or the provider default.
+func resolveModelName(body *types.RequestChatBody) string {
+	if body.Credential.Model != nil {
+		return *body.Credential.Model
+	}
+	return llm.DefaultModelsLangChain[body.Credential.Provider]
+}
+
 func ChatHandler(c fiber.Ctx) error {
 	requestID := requestid.FromContext(c)
 	utils.VerbosePrintf("[%s] [START REQUEST]\n", requestID)
@@ -58,17 +237,28 @@ func ChatHandler(c fiber.Ctx) error {
 		})
 	}
 
-	availableServers := []string{}
-	if len(body.Servers) > 0 {
-		availableServers = mcp.CheckServers(requestID, body.Servers)
-		if len(availableServers) == 0 {
-			return c.Status(503).JSON(fiber.Map{
-				"error": "No MCP servers available",
+	ctx := c.Context()
+
+	discovery := mcp.CheckServers(requestID, ctx, body.Servers)
+	if len(body.Servers) > 0 && len(discovery.Servers) == 0 {
+		return c.Status(503).JSON(fiber.Map{
+			"error":   "No MCP servers available",
+			"servers": discovery.Statuses,
+		})
+	}
+
+	if err := applyServerContext(requestID, ctx, &body, discovery.Servers); err != nil {
+		if errReq, ok := err.(*types.ErrorRequest); ok {
+			return c.Status(errReq.Code).JSON(fiber.Map{
+				"error": errReq.Message,
 			})
 		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
 	}
 
-	ag, err := agent.CreateLangChainAgent(requestID, body.Credential, availableServers, body.SystemPrompt)
+	ag, err := agent.CreateLangChainAgent(requestID, ctx, body.Credential, discovery, body.Tools, body.ToolRetrieval, body.SystemPrompt, body.ResponseFormat)
 	if err != nil {
 		if errReq, ok := err.(*types.ErrorRequest); ok {
 			return c.Status(errReq.Code).JSON(fiber.Map{
@@ -80,12 +270,17 @@ func ChatHandler(c fiber.Ctx) error {
 		})
 	}
 
-	ctx := c.Context()
 	startTime := time.Now()
 
-	result, err := ag.Invoke(requestID, ctx, body.Input)
+	result, err := ag.Invoke(requestID, ctx, body.AgentInput())
 	executionTime := time.Since(startTime).Milliseconds()
+	record := newUsageRecord(c, &body, "/chat")
+	record.LatencyMs = executionTime
 	if err != nil {
+		record.Status = usage.StatusError
+		record.Error = err.Error()
+		recordSpent(&record, result)
+		usage.Append(record)
 		if errReq, ok := err.(*types.ErrorRequest); ok {
 			return c.Status(errReq.Code).JSON(fiber.Map{
 				"error": errReq.Message,
@@ -103,6 +298,7 @@ func ChatHandler(c fiber.Ctx) error {
 		{
 			Role:    "user",
 			Content: body.Input,
+			Parts:   body.InputParts,
 		},
 	}
 	allMessages = append(allMessages, result.Messages...)
@@ -129,93 +325,66 @@ func ChatHandler(c fiber.Ctx) error {
 	}
 
 	// Calculate iterations, tool calls, and accumulate token usage
-	totalIterations := 0
-	totalToolCalls := 0
-	totalInputTokens := 0
-	totalOutputTokens := 0
-	totalTokensSum := 0
-	totalPromptCached := 0
-	totalPromptAudio := 0
-	totalCompletionAudio := 0
-	totalCompletionReasoning := 0
-	totalReasoningTokens := 0
-	totalThinkingTokens := 0
-	totalAcceptedPrediction := 0
-	totalRejectedPrediction := 0
-	var lastMetadata *types.ResponseMetadata
-
-	for _, msg := range result.Messages {
-		if msg.Role == "assistant" {
-			totalIterations++
-			totalToolCalls += len(msg.ToolCalls)
-
-			// Accumulate token usage from each assistant message
-			if msg.UsageData != nil {
-				totalInputTokens += msg.UsageData.InputTokens
-				totalOutputTokens += msg.UsageData.OutputTokens
-				totalTokensSum += msg.UsageData.TotalTokens
-				totalPromptCached += msg.UsageData.PromptCachedTokens
-				totalPromptAudio += msg.UsageData.PromptAudioTokens
-				totalCompletionAudio += msg.UsageData.CompletionAudioTokens
-				totalCompletionReasoning += msg.UsageData.CompletionReasoningTokens
-				totalReasoningTokens += msg.UsageData.ReasoningTokens
-				totalThinkingTokens += msg.UsageData.ThinkingTokens
-				totalAcceptedPrediction += msg.UsageData.CompletionAcceptedPredictionTokens
-				totalRejectedPrediction += msg.UsageData.CompletionRejectedPredictionTokens
-			}
+	summary := agent.Summarize(result.Messages)
+	response.TotalIterations = summary.TotalIterations
+	response.ToolCallsCount = summary.ToolCallsCount
+	response.UsageMetadata = summary.UsageMetadata
+	response.FinishReason = summary.FinishReason
+	response.Metadata = summary.LastMetadata
+
+	// Report the provider that answered when a fallback was used
+	if summary.LastMetadata != nil && summary.LastMetadata.ModelProvider != "" {
+		response.ModelProvider = summary.LastMetadata.ModelProvider
+		response.ModelName = summary.LastMetadata.ModelName
+	}
 
-			// Keep last metadata
-			if msg.Metadata != nil {
-				lastMetadata = msg.Metadata
-			}
-		}
+	// Estimate cost from the aggregated token usage
+	pricedModel := response.ModelName
+	if pricedModel == "" {
+		pricedModel = resolveModelName(&body)
 	}
 
-	response.TotalIterations = totalIterations
-	response.ToolCallsCount = totalToolCalls
-
-	// Set accumulated token counts
-	if totalTokensSum > 0 {
-		// Create aggregated usage metadata with all fields
-		response.UsageMetadata = &types.UsageMetadata{
-			InputTokens:                        totalInputTokens,
-			OutputTokens:                       totalOutputTokens,
-			TotalTokens:                        totalTokensSum,
-			PromptCachedTokens:                 totalPromptCached,
-			PromptAudioTokens:                  totalPromptAudio,
-			CompletionAudioTokens:              totalCompletionAudio,
-			CompletionReasoningTokens:          totalCompletionReasoning,
-			ReasoningTokens:                    totalReasoningTokens,
-			ThinkingTokens:                     totalThinkingTokens,
-			CompletionAcceptedPredictionTokens: totalAcceptedPrediction,
-			CompletionRejectedPredictionTokens: totalRejectedPrediction,
-		}
-
-		// Set token details if available
-		if totalPromptCached > 0 || totalPromptAudio > 0 {
-			response.UsageMetadata.InputTokenDetails = &types.InputTokenDetails{
-				Audio:     totalPromptAudio,
-				CacheRead: totalPromptCached,
-			}
-		}
-		if totalCompletionAudio > 0 || totalCompletionReasoning > 0 {
-			response.UsageMetadata.OutputTokenDetails = &types.OutputTokenDetails{
-				Audio:     totalCompletionAudio,
-				Reasoning: totalCompletionReasoning,
+	// Parse the final answer against response_format, repairing it if needed
+	if body.ResponseFormat != nil {
+		structured, err := ag.StructuredAnswer(requestID, ctx, response.Message, body.ResponseFormat)
+		response.UsageMetadata = agent.MergeUsage(response.UsageMetadata, structured.Usage)
+		if err != nil {
+			record.Status = usage.StatusError
+			record.Error = err.Error()
+			record.Provider = response.ModelProvider
+			record.Model = pricedModel
+			record.SetUsage(response.UsageMetadata)
+			record.SetCost(pricing.Estimate(response.ModelProvider, pricedModel, response.UsageMetadata))
+			usage.Append(record)
+			if errReq, ok := err.(*types.ErrorRequest); ok {
+				return c.Status(errReq.Code).JSON(fiber.Map{
+					"error":   errReq.Message,
+					"message": response.Message,
+				})
 			}
+			return c.Status(500).JSON(fiber.Map{
+				"error": err.Error(),
+			})
 		}
+		response.Structured = structured.Value
 	}
 
-	// Set metadata from last assistant message
-	if lastMetadata != nil {
-		response.FinishReason = lastMetadata.FinishReason
-	}
+	response.Cost = pricing.Estimate(response.ModelProvider, pricedModel, response.UsageMetadata)
 
 	// Calculate tokens per second
-	if response.UsageMetadata.TotalTokens > 0 && executionTimeSec > 0 {
+	if response.UsageMetadata != nil && response.UsageMetadata.TotalTokens > 0 && executionTimeSec > 0 {
 		response.TokensPerSecond = float64(response.UsageMetadata.TotalTokens) / executionTimeSec
 	}
 
+	record.Status = usage.StatusSuccess
+	record.Provider = response.ModelProvider
+	record.Model = pricedModel
+	record.Iterations = summary.TotalIterations
+	record.ToolCalls = summary.ToolCallsCount
+	record.SetUsage(response.UsageMetadata)
+	record.SetCost(response.Cost)
+	usage.Append(record)
+
 	utils.VerbosePrintf("[%s] [END REQUEST]\n", requestID)
 	return c.JSON(response)
 }
@@ -258,12 +427,15 @@ func ChatStreamHandler(c fiber.Ctx) error {
 		"input":     body.Input,
 	})
 
-	availableServers := mcp.CheckServers(requestID, body.Servers)
-	if len(availableServers) == 0 {
+	ctx := c.Context()
+
+	discovery := mcp.CheckServers(requestID, ctx, body.Servers)
+	if len(discovery.Servers) == 0 {
 		sendEvent(map[string]interface{}{
 			"type":      "error",
 			"error":     "No MCP servers available",
 			"code":      503,
+			"servers":   discovery.Statuses,
 			"timestamp": time.Now().Format(time.RFC3339),
 		})
 		return nil
@@ -271,11 +443,26 @@ func ChatStreamHandler(c fiber.Ctx) error {
 
 	sendEvent(map[string]interface{}{
 		"type":              "servers_checked",
-		"available_servers": availableServers,
+		"available_servers": types.ServerNames(discovery.Servers),
 		"total_servers":     len(body.Servers),
+		"servers":           discovery.Statuses,
 	})
 
-	ag, err := agent.CreateLangChainAgent(requestID, body.Credential, availableServers, body.SystemPrompt)
+	if err := applyServerContext(requestID, ctx, &body, discovery.Servers); err != nil {
+		errorCode := 500
+		if errReq, ok := err.(*types.ErrorRequest); ok {
+			errorCode = errReq.Code
+		}
+		sendEvent(map[string]interface{}{
+			"type":      "error",
+			"error":     err.Error(),
+			"code":      errorCode,
+			"timestamp": time.Now().Format(time.RFC3339),
+		})
+		return nil
+	}
+
+	ag, err := agent.CreateLangChainAgent(requestID, ctx, body.Credential, discovery, body.Tools, body.ToolRetrieval, body.SystemPrompt, body.ResponseFormat)
 	if err != nil {
 		errorCode := 500
 		if errReq, ok := err.(*types.ErrorRequest); ok {
@@ -291,24 +478,62 @@ func ChatStreamHandler(c fiber.Ctx) error {
 	}
 
 	eventChan := make(chan agent.StreamEvent, 100)
-	ctx := c.Context()
+	streamErr := make(chan error, 1)
+	// sendErr is set once the client is gone
+	var sendErr error
+	startTime := time.Now()
+	record := newUsageRecord(c, &body, "/chat/stream")
+
+	// spent is the agent state as the run ended, read once streamErr is
+	// received
+	var spent *types.AgentState
 
 	go func() {
-		if err := ag.StreamInvoke(requestID, ctx, body.Input, eventChan); err != nil {
-			errorCode := 500
-			if errReq, ok := err.(*types.ErrorRequest); ok {
-				errorCode = errReq.Code
-			}
-			sendEvent(map[string]interface{}{
-				"type":      "error",
-				"error":     err.Error(),
-				"code":      errorCode,
-				"timestamp": time.Now().Format(time.RFC3339),
-			})
-		}
+		state, err := ag.StreamInvoke(requestID, ctx, body.AgentInput(), eventChan)
+		spent = state
+		streamErr <- err
 	}()
 
 	for event := range eventChan {
+		// Record and price the final summary reported with the done event
+		if event.Type == "done" {
+			if iterations, ok := event.Data["total_iterations"].(int); ok {
+				record.Iterations = iterations
+			}
+			if toolCalls, ok := event.Data["tool_calls_count"].(int); ok {
+				record.ToolCalls = toolCalls
+			}
+			if provider, ok := event.Data["model_provider"].(string); ok && provider != "" {
+				record.Provider = provider
+			}
+			if model, ok := event.Data["model_name"].(string); ok && model != "" {
+				record.Model = model
+			}
+			if body.ResponseFormat != nil {
+				message, _ := event.Data["message"].(string)
+				usageData, _ := event.Data["usage_metadata"].(*types.UsageMetadata)
+				structured, err := ag.StructuredAnswer(requestID, ctx, message, body.ResponseFormat)
+				if merged := agent.MergeUsage(usageData, structured.Usage); merged != nil {
+					event.Data["usage_metadata"] = merged
+				}
+				if err != nil {
+					event.Data["structured_error"] = err.Error()
+					record.Status = usage.StatusError
+					record.Error = err.Error()
+				} else {
+					event.Data["structured"] = structured.Value
+				}
+			}
+			if usageData, ok := event.Data["usage_metadata"].(*types.UsageMetadata); ok && usageData != nil {
+				cost := pricing.Estimate(record.Provider, record.Model, usageData)
+				if cost != nil {
+					event.Data["cost"] = cost
+				}
+				record.SetUsage(usageData)
+				record.SetCost(cost)
+			}
+		}
+
 		eventData := map[string]interface{}{
 			"type": event.Type,
 		}
@@ -318,10 +543,38 @@ func ChatStreamHandler(c fiber.Ctx) error {
 		for k, v := range event.Data {
 			eventData[k] = v
 		}
-		if err := sendEvent(eventData); err != nil {
-			return err
+		// Keep draining after the client is gone, so the agent is not blocked
+		// and the tokens it already used are still recorded
+		if sendErr == nil {
+			sendErr = sendEvent(eventData)
 		}
 	}
 
-	return nil
+	record.LatencyMs = time.Since(startTime).Milliseconds()
+	if record.Status == "" {
+		record.Status = usage.StatusSuccess
+	}
+	if err := <-streamErr; err != nil {
+		record.Status = usage.StatusError
+		record.Error = err.Error()
+		// No done event was sent, so take what was spent from the state
+		recordSpent(&record, spent)
+
+		errorCode := 500
+		if errReq, ok := err.(*types.ErrorRequest); ok {
+			errorCode = errReq.Code
+		}
+		sendEvent(map[string]interface{}{
+			"type":      "error",
+			"error":     err.Error(),
+			"code":      errorCode,
+			"timestamp": time.Now().Format(time.RFC3339),
+		})
+	} else if sendErr != nil {
+		record.Status = usage.StatusError
+		record.Error = "client disconnected: " + sendErr.Error()
+	}
+	usage.Append(record)
+
+	return sendErr
 }
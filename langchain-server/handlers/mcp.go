@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+
+	"langchain-mcp-api/mcp"
+	"langchain-mcp-api/types"
+	"langchain-mcp-api/utils"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
+)
+
+// CatalogHandler serves POST /mcp/catalog: the resources and prompts of the
+// given servers, to pick from before sending a chat request.
+func CatalogHandler(c fiber.Ctx) error {
+	requestID := requestid.FromContext(c)
+	utils.VerbosePrintf("[%s] [START CATALOG]\n", requestID)
+
+	var body struct {
+		Servers []types.MCPServer `json:"servers"`
+	}
+	if err := c.Bind().JSON(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if len(body.Servers) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Missing servers",
+		})
+	}
+	servers, err := resolveServers(body.Servers)
+	if err != nil {
+		if errReq, ok := err.(*types.ErrorRequest); ok {
+			return c.Status(errReq.Code).JSON(fiber.Map{
+				"error": errReq.Message,
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	catalogs := mcp.Catalog(requestID, c.Context(), servers)
+
+	utils.VerbosePrintf("[%s] [END CATALOG]\n", requestID)
+	return c.JSON(fiber.Map{
+		"servers": catalogs,
+	})
+}
+
+// ServersHandler serves GET /mcp/servers: the registered servers with their
+// circuit breaker state, latency percentiles and error counts. Admins also
+// get their URLs and the servers clients named by URL.
+func ServersHandler(c fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"servers": mcp.ServerHealth(isAdmin(c)),
+	})
+}
+
+// RegisterServerHandler serves POST /mcp/servers: adds a server to the
+// registry or replaces the one with the same alias. Admin only.
+func RegisterServerHandler(c fiber.Ctx) error {
+	if ok, err := requireAdmin(c); !ok {
+		return err
+	}
+
+	var entry types.RegisteredServer
+	if err := c.Bind().JSON(&entry); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	created, err := mcp.Register(entry)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid server: %v", err),
+		})
+	}
+	log.Printf("[MCP] Server %s registered\n", entry.Alias)
+
+	status := 200
+	if created {
+		status = 201
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"alias":   entry.Alias,
+		"created": created,
+	})
+}
+
+// UnregisterServerHandler serves DELETE /mcp/servers/:alias. Admin only.
+func UnregisterServerHandler(c fiber.Ctx) error {
+	if ok, err := requireAdmin(c); !ok {
+		return err
+	}
+
+	alias := c.Params("alias")
+	if !mcp.Unregister(alias) {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fmt.Sprintf("Unknown server %s", alias),
+		})
+	}
+	log.Printf("[MCP] Server %s unregistered\n", alias)
+	return c.JSON(fiber.Map{
+		"alias":   alias,
+		"deleted": true,
+	})
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"langchain-mcp-api/agent"
+	"langchain-mcp-api/pricing"
+	"langchain-mcp-api/types"
+	"langchain-mcp-api/usage"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
+)
+
+// newUsageRecord prepares a ledger record for a chat request. Requests are
+// keyed by the caller's X-API-Key header, falling back to the provider key,
+// and grouped into sessions by X-Session-ID. Keys are only stored as
+// fingerprints.
+func newUsageRecord(c fiber.Ctx, body *types.RequestChatBody, endpoint string) usage.Record {
+	record := usage.Record{
+		RequestID: requestid.FromContext(c),
+		Timestamp: time.Now().UTC(),
+		Endpoint:  endpoint,
+		SessionID: c.Get("X-Session-ID"),
+		Provider:  body.Credential.Provider,
+		Model:     resolveModelName(body),
+	}
+
+	if apiKey := c.Get("X-API-Key"); apiKey != "" {
+		record.APIKey = usage.KeyFingerprint(apiKey)
+	} else if body.Credential.APIKey != nil {
+		record.APIKey = usage.KeyFingerprint(*body.Credential.APIKey)
+	}
+
+	return record
+}
+
+// recordSpent copies the tokens a failed run already spent into its ledger
+// record, so that failures are billed for what they used.
+func recordSpent(record *usage.Record, state *types.AgentState) {
+	if state == nil {
+		return
+	}
+	summary := agent.Summarize(state.Messages)
+	if summary.LastMetadata != nil && summary.LastMetadata.ModelProvider != "" {
+		record.Provider = summary.LastMetadata.ModelProvider
+		record.Model = summary.LastMetadata.ModelName
+	}
+	record.Iterations = summary.TotalIterations
+	record.ToolCalls = summary.ToolCallsCount
+	record.SetUsage(summary.UsageMetadata)
+	record.SetCost(pricing.Estimate(record.Provider, record.Model, summary.UsageMetadata))
+}
+
+func parseUsageTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// UsageHandler serves GET /usage. Supported query parameters: from, to
+// (RFC3339 or YYYY-MM-DD), provider, model, api_key, session_id, status,
+// group_by (day, model, provider, key, session) and limit. The ledger
+// covers every caller, so it is admin only.
+func UsageHandler(c fiber.Ctx) error {
+	if ok, err := requireAdmin(c); !ok {
+		return err
+	}
+
+	ledger := usage.Default()
+	if ledger == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Usage ledger is disabled",
+		})
+	}
+
+	filter := usage.Filter{
+		Provider:  c.Query("provider"),
+		Model:     c.Query("model"),
+		APIKey:    c.Query("api_key"),
+		SessionID: c.Query("session_id"),
+		Status:    c.Query("status"),
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, err := parseUsageTime(from, false)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid from date",
+			})
+		}
+		filter.From = t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseUsageTime(to, true)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid to date",
+			})
+		}
+		filter.To = t
+	}
+
+	records, err := ledger.Query(filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	response := fiber.Map{
+		"totals": usage.Sum(records),
+	}
+
+	if groupBy := c.Query("group_by"); groupBy != "" {
+		groups, err := usage.Group(records, groupBy)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		response["group_by"] = groupBy
+		response["groups"] = groups
+		return c.JSON(response)
+	}
+
+	// Return the most recent records when not grouping
+	limit := 100
+	if value := c.Query("limit"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	if len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	response["records"] = records
+
+	return c.JSON(response)
+}
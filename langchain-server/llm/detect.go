@@ -0,0 +1,233 @@
+package llm
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"langchain-mcp-api/types"
+	"langchain-mcp-api/utils"
+)
+
+// Tool calling modes accepted in set.tool_calling.
+const (
+	ToolCallingAuto   = "auto"
+	ToolCallingNative = "native"
+	ToolCallingManual = "manual"
+)
+
+const probeTimeout = 10 * time.Second
+
+// toolSupportCacheSize bounds the probe results kept, as their keys come
+// from client-supplied URLs.
+const toolSupportCacheSize = 256
+
+// ToolProbe reports whether the model served behind a credential supports
+// OpenAI-style tool calling.
+type ToolProbe func(ctx context.Context, credential types.RequestChatCredential, model string) (bool, error)
+
+var probeClient = &http.Client{Timeout: probeTimeout}
+
+// Probes for the OpenAI-compatible servers, each sent over the same
+// transport as the provider client so both reach the same servers.
+var (
+	probeOpenAITools   = openAIToolProbe(probeClient)
+	probeLlamaCPPTools = openAIToolProbe(&http.Client{Timeout: probeTimeout, Transport: llamaCPPTransport})
+)
+
+// toolSupportCache remembers probe results per provider, URL and model so a
+// backend is only probed once per process, evicting the least recently used
+// beyond toolSupportCacheSize.
+var toolSupportCache = struct {
+	sync.Mutex
+	order *list.List // front is most recently used
+	byKey map[string]*list.Element
+}{order: list.New(), byKey: map[string]*list.Element{}}
+
+type toolSupport struct {
+	key       string
+	supported bool
+}
+
+func cachedToolSupport(key string) (bool, bool) {
+	toolSupportCache.Lock()
+	defer toolSupportCache.Unlock()
+	elem, ok := toolSupportCache.byKey[key]
+	if !ok {
+		return false, false
+	}
+	toolSupportCache.order.MoveToFront(elem)
+	return elem.Value.(*toolSupport).supported, true
+}
+
+func storeToolSupport(key string, supported bool) {
+	toolSupportCache.Lock()
+	defer toolSupportCache.Unlock()
+	if elem, ok := toolSupportCache.byKey[key]; ok {
+		elem.Value.(*toolSupport).supported = supported
+		toolSupportCache.order.MoveToFront(elem)
+		return
+	}
+	toolSupportCache.byKey[key] = toolSupportCache.order.PushFront(&toolSupport{key: key, supported: supported})
+	for toolSupportCache.order.Len() > toolSupportCacheSize {
+		oldest := toolSupportCache.order.Back()
+		toolSupportCache.order.Remove(oldest)
+		delete(toolSupportCache.byKey, oldest.Value.(*toolSupport).key)
+	}
+}
+
+// resolveNativeTools decides between native and manual tool calling. An
+// explicit set.tool_calling wins; otherwise providers with a probe are asked
+// once per model, within ctx, and the declared capability is used for the
+// rest.
+func resolveNativeTools(requestID string, ctx context.Context, provider *Provider, credential types.RequestChatCredential, model string) bool {
+	mode := ToolCallingAuto
+	if credential.Set != nil && credential.Set.ToolCalling != nil {
+		mode = *credential.Set.ToolCalling
+	}
+
+	switch mode {
+	case ToolCallingNative:
+		return true
+	case ToolCallingManual:
+		return false
+	}
+	if provider.ProbeTools == nil {
+		return provider.Capabilities.NativeTools
+	}
+
+	url := ""
+	if credential.URL != nil {
+		url = *credential.URL
+	}
+	key := provider.Name + "|" + url + "|" + model
+
+	if supported, ok := cachedToolSupport(key); ok {
+		utils.VerbosePrintf("[%s]   Tool calling support (cached): %v\n", requestID, supported)
+		return supported
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	supported, err := provider.ProbeTools(ctx, credential, model)
+	if err != nil {
+		// Unreachable backends are not cached so a later request can probe again
+		utils.VerbosePrintf("[%s]   ⚠️  Tool calling probe failed: %v\n", requestID, err)
+		return provider.Capabilities.NativeTools
+	}
+	utils.VerbosePrintf("[%s]   Tool calling support (probed): %v\n", requestID, supported)
+
+	storeToolSupport(key, supported)
+	return supported
+}
+
+// probeOllamaTools reads the model's chat template from /api/show. Newer
+// Ollama versions list "tools" in capabilities; older ones only expose the
+// template, which references .Tools when the model supports tool calling.
+func probeOllamaTools(ctx context.Context, credential types.RequestChatCredential, model string) (bool, error) {
+	if credential.URL == nil {
+		return false, fmt.Errorf("missing url")
+	}
+
+	payload, err := json.Marshal(map[string]string{"model": model})
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(*credential.URL, "/")+"/api/show", bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("ollama /api/show returned status %d", resp.StatusCode)
+	}
+
+	var show struct {
+		Template     string   `json:"template"`
+		Capabilities []string `json:"capabilities"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&show); err != nil {
+		return false, err
+	}
+
+	for _, capability := range show.Capabilities {
+		if capability == "tools" {
+			return true, nil
+		}
+	}
+	return strings.Contains(show.Template, ".Tools"), nil
+}
+
+// openAIToolProbe returns a probe sending a one-token chat completion with a
+// dummy tool through client. vLLM without --enable-auto-tool-choice and
+// llama.cpp without --jinja reject the request with a 4xx, servers with tool
+// support accept it.
+func openAIToolProbe(client *http.Client) ToolProbe {
+	return func(ctx context.Context, credential types.RequestChatCredential, model string) (bool, error) {
+		return probeOpenAIToolsWith(ctx, client, credential, model)
+	}
+}
+
+func probeOpenAIToolsWith(ctx context.Context, client *http.Client, credential types.RequestChatCredential, model string) (bool, error) {
+	if credential.URL == nil {
+		return false, fmt.Errorf("missing url")
+	}
+
+	payload, err := json.Marshal(map[string]any{
+		"model":      model,
+		"messages":   []map[string]string{{"role": "user", "content": "ping"}},
+		"max_tokens": 1,
+		"tools": []map[string]any{{
+			"type": "function",
+			"function": map[string]any{
+				"name":        "ping",
+				"description": "Connectivity check",
+				"parameters":  map[string]any{"type": "object", "properties": map[string]any{}},
+			},
+		}},
+		"tool_choice": "auto",
+	})
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(*credential.URL, "/")+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if credential.APIKey != nil {
+		req.Header.Set("Authorization", "Bearer "+*credential.APIKey)
+	}
+	for key, value := range credential.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return true, nil
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnprocessableEntity || resp.StatusCode == http.StatusNotImplemented:
+		return false, nil
+	default:
+		return false, fmt.Errorf("tool probe returned status %d", resp.StatusCode)
+	}
+}
@@ -2,55 +2,47 @@ package llm
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
-	"net/http"
-	"time"
 
 	"langchain-mcp-api/types"
 	"langchain-mcp-api/utils"
 
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/anthropic"
-	"github.com/tmc/langchaingo/llms/ollama"
-	"github.com/tmc/langchaingo/llms/openai"
 )
 
-var DefaultModelsLangChain = map[string]string{
-	"openai":     "gpt-4o-mini",
-	"claude":     "claude-3-5-sonnet-20241022",
-	"openrouter": "anthropic/claude-3.5-sonnet",
-	"ollama":     "llama3.2",
-	"llama_cpp":  "Qwen/Qwen3-8B-GGUF:Q8_0",
-	"vllm":       "meta-llama/Llama-3.2-3B-Instruct",
-}
-
 type LangChainClient struct {
-	LLM           llms.Model
-	Provider      string
-	Model         string
-	URL           *string
-	Config        *types.SetLLM
-	SupportsTools bool
+	LLM          llms.Model
+	Provider     string
+	Model        string
+	URL          *string
+	Config       *types.SetLLM
+	Capabilities Capabilities
+	Fallbacks    []*LangChainClient
 }
 
-func CreateLangChainLLM(requestID string, credential types.RequestChatCredential) (*LangChainClient, error) {
+func CreateLangChainLLM(requestID string, ctx context.Context, credential types.RequestChatCredential) (*LangChainClient, error) {
 	utils.VerbosePrintf("\n[%s]🔧 [LLM] Creating LangChain LLM client...\n", requestID)
-	provider := credential.Provider
+	provider, ok := GetProvider(credential.Provider)
+	if !ok {
+		return nil, types.NewErrorRequest(fmt.Sprintf("Unsupported provider: %s", credential.Provider), 404)
+	}
 
-	model := DefaultModelsLangChain[provider]
+	model := provider.DefaultModel
 	if credential.Model != nil {
 		model = *credential.Model
 	}
-	utils.VerbosePrintf("[%s]   Provider: %s\n", requestID, provider)
+	utils.VerbosePrintf("[%s]   Provider: %s\n", requestID, provider.Name)
 	utils.VerbosePrintf("[%s]   Model: %s\n", requestID, model)
+	utils.VerbosePrintf("[%s]   Capabilities: %+v\n", requestID, provider.Capabilities)
 
 	client := &LangChainClient{
-		Provider: provider,
-		Model:    model,
-		URL:      credential.URL,
-		Config:   credential.Set,
+		Provider:     provider.Name,
+		Model:        model,
+		URL:          credential.URL,
+		Config:       credential.Set,
+		Capabilities: provider.Capabilities,
 	}
+	client.Capabilities.NativeTools = resolveNativeTools(requestID, ctx, provider, credential, model)
 
 	if credential.Set != nil {
 		utils.VerbosePrintf("[%s]   Configuration:\n", requestID)
@@ -65,97 +57,7 @@ func CreateLangChainLLM(requestID string, credential types.RequestChatCredential
 		}
 	}
 
-	toolCallingProviders := []string{"openai", "claude", "openrouter"}
-	client.SupportsTools = containsString(toolCallingProviders, provider)
-
-	var llmInstance llms.Model
-	var err error
-
-	switch provider {
-	case "openai":
-		if credential.APIKey == nil {
-			return nil, types.NewErrorRequest("OpenAI API key is required", 401)
-		}
-
-		llmInstance, err = openai.New(
-			openai.WithToken(*credential.APIKey),
-			openai.WithModel(model),
-		)
-
-	case "claude":
-		if credential.APIKey == nil {
-			return nil, types.NewErrorRequest("Claude API key is required", 401)
-		}
-
-		llmInstance, err = anthropic.New(
-			anthropic.WithToken(*credential.APIKey),
-			anthropic.WithModel(model),
-		)
-
-	case "openrouter":
-		if credential.APIKey == nil {
-			return nil, types.NewErrorRequest("OpenRouter API key is required", 401)
-		}
-
-		llmInstance, err = openai.New(
-			openai.WithToken(*credential.APIKey),
-			openai.WithModel(model),
-			openai.WithBaseURL("https://openrouter.ai/api/v1"),
-		)
-
-	case "ollama":
-		if credential.URL == nil {
-			return nil, types.NewErrorRequest("Ollama URL is required", 400)
-		}
-
-		llmInstance, err = ollama.New(
-			ollama.WithModel(model),
-			ollama.WithServerURL(*credential.URL),
-		)
-
-	case "llama_cpp":
-		if credential.URL == nil {
-			return nil, types.NewErrorRequest("Llama.cpp URL is required", 400)
-		}
-
-		utils.VerbosePrintf("[%s]   Llama.cpp BaseURL: %s\n", requestID, *credential.URL)
-
-		// Create custom HTTP client with longer timeout and TLS skip verify
-		httpClient := &http.Client{
-			Timeout: 300 * time.Second,
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true,
-				},
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 100,
-				IdleConnTimeout:     90 * time.Second,
-			},
-		}
-		utils.VerbosePrintf("[%s]   Using custom HTTP client (timeout: 300s, TLS skip verify: true)\n", requestID)
-
-		llmInstance, err = openai.New(
-			openai.WithToken("llama_cpp"),
-			openai.WithModel(model),
-			openai.WithBaseURL(*credential.URL),
-			openai.WithHTTPClient(httpClient),
-		)
-
-	case "vllm":
-		if credential.URL == nil {
-			return nil, types.NewErrorRequest("vLLM URL is required", 400)
-		}
-
-		llmInstance, err = openai.New(
-			openai.WithToken("vllm"),
-			openai.WithModel(model),
-			openai.WithBaseURL(*credential.URL),
-		)
-
-	default:
-		return nil, types.NewErrorRequest(fmt.Sprintf("Unsupported provider: %s", provider), 404)
-	}
-
+	llmInstance, err := provider.New(requestID, ctx, credential, model)
 	if err != nil {
 		utils.VerbosePrintf("[%s]   ❌ Failed to create LLM: %v\n", requestID, err)
 		return nil, err
@@ -163,6 +65,17 @@ func CreateLangChainLLM(requestID string, credential types.RequestChatCredential
 
 	utils.VerbosePrintf("[%s]   LLM client created successfully\n", requestID)
 	client.LLM = llmInstance
+
+	for idx, fallback := range credential.Fallbacks {
+		utils.VerbosePrintf("[%s]   Creating fallback %d/%d...\n", requestID, idx+1, len(credential.Fallbacks))
+		// Fallbacks of fallbacks are ignored
+		fallback.Fallbacks = nil
+		fallbackClient, err := CreateLangChainLLM(requestID, ctx, fallback)
+		if err != nil {
+			return nil, err
+		}
+		client.Fallbacks = append(client.Fallbacks, fallbackClient)
+	}
 	utils.VerbosePrintf("\n[%s] [LLM] LangChain LLM client created (provider: %s, model: %s)\n", requestID, client.Provider, client.Model)
 	return client, nil
 }
@@ -171,12 +84,7 @@ func (c *LangChainClient) GenerateContent(requestID string, ctx context.Context,
 	utils.VerbosePrintf("\n[%s] [LLM] GenerateContent called (provider: %s, model: %s)\n", requestID, c.Provider, c.Model)
 	utils.VerbosePrintf("[%s]   Messages: %d\n", requestID, len(messages))
 
-	// Build call options from config
-	callOpts := c.buildCallOptions()
-	callOpts = append(callOpts, options...)
-	utils.VerbosePrintf("[%s]   CallOptions: %d\n", requestID, len(callOpts))
-
-	result, err := c.LLM.GenerateContent(ctx, messages, callOpts...)
+	result, err := c.generateWithFallback(requestID, ctx, messages, nil, options...)
 	if err != nil {
 		utils.VerbosePrintf("[%s]   ❌ GenerateContent error: %v\n", requestID, err)
 		utils.VerbosePrintf("[%s]   Provider: %s, Model: %s\n", requestID, c.Provider, c.Model)
@@ -201,12 +109,7 @@ func (c *LangChainClient) GenerateContentWithMetadata(requestID string, ctx cont
 	utils.VerbosePrintf("\n[%s] [LLM] GenerateContent called (provider: %s, model: %s)\n", requestID, c.Provider, c.Model)
 	utils.VerbosePrintf("[%s]   Messages: %d\n", requestID, len(messages))
 
-	// Build call options from config
-	callOpts := c.buildCallOptions()
-	callOpts = append(callOpts, options...)
-	utils.VerbosePrintf("[%s]   CallOptions: %d\n", requestID, len(callOpts))
-
-	result, err := c.LLM.GenerateContent(ctx, messages, callOpts...)
+	result, err := c.generateWithFallback(requestID, ctx, messages, nil, options...)
 	if err != nil {
 		utils.VerbosePrintf("[%s]   ❌ GenerateContent error: %v\n", requestID, err)
 		utils.VerbosePrintf("[%s]   Provider: %s, Model: %s\n", requestID, c.Provider, c.Model)
@@ -227,23 +130,25 @@ func (c *LangChainClient) GenerateContentWithMetadata(requestID string, ctx cont
 	return content, result, nil
 }
 
-func (c *LangChainClient) StreamGenerateContent(requestID string, ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (<-chan string, <-chan error) {
+// StreamGenerateContent streams content chunks and, once streaming has
+// finished, delivers the final response (usage, finish reason) on the result
+// channel before the content channel is closed.
+func (c *LangChainClient) StreamGenerateContent(requestID string, ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (<-chan string, <-chan *llms.ContentResponse, <-chan error) {
 	utils.VerbosePrintf("\n[%s] [LLM] StreamGenerateContent called (provider: %s, model: %s)\n", requestID, c.Provider, c.Model)
 	utils.VerbosePrintf("[%s]   Messages: %d\n", requestID, len(messages))
 
 	contentChan := make(chan string, 100)
+	resultChan := make(chan *llms.ContentResponse, 1)
 	errChan := make(chan error, 1)
 
 	go func() {
 		defer close(contentChan)
+		defer close(resultChan)
 		defer close(errChan)
 
-		// Build call options from config
-		callOpts := c.buildCallOptions()
-		callOpts = append(callOpts, options...)
-
 		chunkCount := 0
-		callOpts = append(callOpts, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+		streamOpts := append([]llms.CallOption{}, options...)
+		streamOpts = append(streamOpts, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
 			chunkCount++
 			if chunkCount%10 == 0 {
 				utils.VerbosePrintf("[%s]   📦 Received %d chunks...\n", requestID, chunkCount)
@@ -252,16 +157,20 @@ func (c *LangChainClient) StreamGenerateContent(requestID string, ctx context.Co
 			return nil
 		}))
 
-		_, err := c.LLM.GenerateContent(ctx, messages, callOpts...)
+		// Retrying after chunks were sent would duplicate content
+		canRetry := func() bool { return chunkCount == 0 }
+
+		result, err := c.generateWithFallback(requestID, ctx, messages, canRetry, streamOpts...)
 		if err != nil {
 			utils.VerbosePrintf("[%s]   ❌ Streaming error: %v\n", requestID, err)
 			errChan <- err
 		} else {
 			utils.VerbosePrintf("[%s]   ✅ Streaming completed (%d total chunks)\n", requestID, chunkCount)
+			resultChan <- result
 		}
 	}()
 
-	return contentChan, errChan
+	return contentChan, resultChan, errChan
 }
 
 func (c *LangChainClient) buildCallOptions() []llms.CallOption {
@@ -292,12 +201,3 @@ func (c *LangChainClient) buildCallOptions() []llms.CallOption {
 
 	return opts
 }
-
-func containsString(slice []string, item string) bool {
-	for _, s := range slice {
-		if s == item {
-			return true
-		}
-	}
-	return false
-}
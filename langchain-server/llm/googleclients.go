@@ -0,0 +1,74 @@
+package llm
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// googleClientCacheSize bounds the Gemini and Vertex clients kept open.
+const googleClientCacheSize = 64
+
+// googleClientCloseDelay is how long an evicted client stays open, so the
+// requests still using it can finish.
+const googleClientCloseDelay = 10 * time.Minute
+
+// googleClient is a Gemini or Vertex model. Both hold gRPC connections, so
+// they are shared between requests instead of being created per request.
+type googleClient interface {
+	llms.Model
+	Close() error
+}
+
+type googleClientEntry struct {
+	key    string
+	client googleClient
+}
+
+// googleClients caches one client per provider, credentials, project,
+// location and model, evicting the least recently used beyond
+// googleClientCacheSize.
+var googleClients = struct {
+	sync.Mutex
+	order *list.List // front is most recently used
+	byKey map[string]*list.Element
+}{order: list.New(), byKey: map[string]*list.Element{}}
+
+// googleClientKey hashes the client settings, so credentials are not kept
+// as map keys.
+func googleClientKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// sharedGoogleClient returns the cached client for key, creating it with
+// create. The lock is held while creating, so concurrent first requests
+// open a single client.
+func sharedGoogleClient(key string, create func() (googleClient, error)) (llms.Model, error) {
+	googleClients.Lock()
+	defer googleClients.Unlock()
+
+	if elem, ok := googleClients.byKey[key]; ok {
+		googleClients.order.MoveToFront(elem)
+		return elem.Value.(*googleClientEntry).client, nil
+	}
+
+	client, err := create()
+	if err != nil {
+		return nil, err
+	}
+	googleClients.byKey[key] = googleClients.order.PushFront(&googleClientEntry{key: key, client: client})
+	for googleClients.order.Len() > googleClientCacheSize {
+		oldest := googleClients.order.Back()
+		googleClients.order.Remove(oldest)
+		entry := oldest.Value.(*googleClientEntry)
+		delete(googleClients.byKey, entry.key)
+		time.AfterFunc(googleClientCloseDelay, func() { entry.client.Close() })
+	}
+	return client, nil
+}
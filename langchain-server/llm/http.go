@@ -0,0 +1,29 @@
+package llm
+
+import "net/http"
+
+// headerTransport adds fixed headers to every outgoing request, e.g. for
+// gateways and proxies that expect their own auth or routing headers.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// newHeaderClient returns an HTTP client that sends headers with every
+// request.
+func newHeaderClient(headers map[string]string) *http.Client {
+	return &http.Client{
+		Transport: &headerTransport{
+			base:    http.DefaultTransport,
+			headers: headers,
+		},
+	}
+}
@@ -0,0 +1,384 @@
+package llm
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"langchain-mcp-api/env"
+	"langchain-mcp-api/types"
+	"langchain-mcp-api/utils"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/anthropic"
+	"github.com/tmc/langchaingo/llms/bedrock"
+	"github.com/tmc/langchaingo/llms/cohere"
+	"github.com/tmc/langchaingo/llms/googleai"
+	"github.com/tmc/langchaingo/llms/googleai/vertex"
+	"github.com/tmc/langchaingo/llms/mistral"
+	"github.com/tmc/langchaingo/llms/ollama"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+const defaultAzureAPIVersion = "2024-06-01"
+
+func init() {
+	RegisterProvider(&Provider{
+		Name:           "openai",
+		DefaultModel:   "gpt-4o-mini",
+		RequiresAPIKey: true,
+		Capabilities:   Capabilities{NativeTools: true, Streaming: true, Vision: true, JSONMode: true, Reasoning: true, SystemPrompt: true},
+		Usage:          normalizeOpenAIUsage,
+		New:            newOpenAI,
+	})
+	RegisterProvider(&Provider{
+		Name:           "claude",
+		DefaultModel:   "claude-3-5-sonnet-20241022",
+		RequiresAPIKey: true,
+		Capabilities:   Capabilities{NativeTools: true, Streaming: true, Vision: true, Reasoning: true, SystemPrompt: true},
+		Usage:          normalizeAnthropicUsage,
+		New:            newClaude,
+	})
+	RegisterProvider(&Provider{
+		Name:           "openrouter",
+		DefaultModel:   "anthropic/claude-3.5-sonnet",
+		RequiresAPIKey: true,
+		Capabilities:   Capabilities{NativeTools: true, Streaming: true, Vision: true, JSONMode: true, SystemPrompt: true},
+		Usage:          normalizeOpenAIUsage,
+		New:            newOpenRouter,
+	})
+	RegisterProvider(&Provider{
+		Name:           "gemini",
+		DefaultModel:   "gemini-2.0-flash",
+		RequiresAPIKey: true,
+		Capabilities:   Capabilities{NativeTools: true, Streaming: true, Vision: true, JSONMode: true, Reasoning: true, SystemPrompt: true},
+		Usage:          normalizeGoogleUsage,
+		New:            newGemini,
+	})
+	RegisterProvider(&Provider{
+		Name:            "vertex",
+		DefaultModel:    "gemini-2.0-flash",
+		RequiresProject: true,
+		Capabilities:    Capabilities{NativeTools: true, Streaming: true, Vision: true, JSONMode: true, Reasoning: true, SystemPrompt: true},
+		Usage:           normalizeGoogleUsage,
+		New:             newVertex,
+	})
+	RegisterProvider(&Provider{
+		Name:           "azure_openai",
+		DefaultModel:   "gpt-4o-mini",
+		RequiresAPIKey: true,
+		RequiresURL:    true,
+		Capabilities:   Capabilities{NativeTools: true, Streaming: true, Vision: true, JSONMode: true, Reasoning: true, SystemPrompt: true},
+		Usage:          normalizeOpenAIUsage,
+		New:            newAzureOpenAI,
+	})
+	RegisterProvider(&Provider{
+		Name:         "openai_compatible",
+		RequiresURL:  true,
+		Capabilities: Capabilities{Streaming: true, SystemPrompt: true},
+		Usage:        normalizeOpenAIUsage,
+		New:          newOpenAICompatible,
+		ProbeTools:   probeOpenAITools,
+	})
+	RegisterProvider(&Provider{
+		Name:           "mistral",
+		DefaultModel:   "mistral-small-latest",
+		RequiresAPIKey: true,
+		Capabilities:   Capabilities{NativeTools: true, Streaming: true, SystemPrompt: true},
+		New:            newMistral,
+	})
+	RegisterProvider(&Provider{
+		Name:           "cohere",
+		DefaultModel:   "command-r",
+		RequiresAPIKey: true,
+		Capabilities:   Capabilities{},
+		New:            newCohere,
+	})
+	RegisterProvider(&Provider{
+		Name:         "bedrock",
+		DefaultModel: "anthropic.claude-3-5-sonnet-20241022-v2:0",
+		Capabilities: Capabilities{Vision: true, SystemPrompt: true},
+		New:          newBedrock,
+	})
+	RegisterProvider(&Provider{
+		Name:         "ollama",
+		DefaultModel: "llama3.2",
+		RequiresURL:  true,
+		Capabilities: Capabilities{Streaming: true, JSONMode: true, SystemPrompt: true},
+		Usage:        normalizeOllamaUsage,
+		New:          newOllama,
+		ProbeTools:   probeOllamaTools,
+	})
+	RegisterProvider(&Provider{
+		Name:         "llama_cpp",
+		DefaultModel: "Qwen/Qwen3-8B-GGUF:Q8_0",
+		RequiresURL:  true,
+		Capabilities: Capabilities{Streaming: true, SystemPrompt: true},
+		Usage:        normalizeOpenAIUsage,
+		New:          newLlamaCPP,
+		ProbeTools:   probeLlamaCPPTools,
+	})
+	RegisterProvider(&Provider{
+		Name:         "vllm",
+		DefaultModel: "meta-llama/Llama-3.2-3B-Instruct",
+		RequiresURL:  true,
+		Capabilities: Capabilities{Streaming: true, SystemPrompt: true},
+		Usage:        normalizeOpenAIUsage,
+		New:          newVLLM,
+		ProbeTools:   probeOpenAITools,
+	})
+}
+
+func newOpenAI(requestID string, ctx context.Context, credential types.RequestChatCredential, model string) (llms.Model, error) {
+	if credential.APIKey == nil {
+		return nil, types.NewErrorRequest("OpenAI API key is required", 401)
+	}
+
+	return openai.New(
+		openai.WithToken(*credential.APIKey),
+		openai.WithModel(model),
+	)
+}
+
+func newClaude(requestID string, ctx context.Context, credential types.RequestChatCredential, model string) (llms.Model, error) {
+	if credential.APIKey == nil {
+		return nil, types.NewErrorRequest("Claude API key is required", 401)
+	}
+
+	return anthropic.New(
+		anthropic.WithToken(*credential.APIKey),
+		anthropic.WithModel(model),
+	)
+}
+
+func newOpenRouter(requestID string, ctx context.Context, credential types.RequestChatCredential, model string) (llms.Model, error) {
+	if credential.APIKey == nil {
+		return nil, types.NewErrorRequest("OpenRouter API key is required", 401)
+	}
+
+	return openai.New(
+		openai.WithToken(*credential.APIKey),
+		openai.WithModel(model),
+		openai.WithBaseURL("https://openrouter.ai/api/v1"),
+	)
+}
+
+func newGemini(requestID string, ctx context.Context, credential types.RequestChatCredential, model string) (llms.Model, error) {
+	if credential.APIKey == nil {
+		return nil, types.NewErrorRequest("Gemini API key is required", 401)
+	}
+
+	key := googleClientKey("gemini", *credential.APIKey, model)
+	return sharedGoogleClient(key, func() (googleClient, error) {
+		return googleai.New(
+			context.WithoutCancel(ctx),
+			googleai.WithAPIKey(*credential.APIKey),
+			googleai.WithDefaultModel(model),
+		)
+	})
+}
+
+func newVertex(requestID string, ctx context.Context, credential types.RequestChatCredential, model string) (llms.Model, error) {
+	if credential.Project == nil {
+		return nil, types.NewErrorRequest("Vertex project is required", 400)
+	}
+
+	location := "us-central1"
+	if credential.Location != nil {
+		location = *credential.Location
+	}
+	utils.VerbosePrintf("[%s]   Vertex project: %s, location: %s\n", requestID, *credential.Project, location)
+
+	vertexOpts := []googleai.Option{
+		googleai.WithCloudProject(*credential.Project),
+		googleai.WithCloudLocation(location),
+		googleai.WithDefaultModel(model),
+	}
+	// Without a service account key the server's application default
+	// credentials are used, when the server allows it
+	serviceAccount := ""
+	if credential.APIKey != nil {
+		serviceAccount = *credential.APIKey
+		vertexOpts = append(vertexOpts, googleai.WithCredentialsJSON([]byte(serviceAccount)))
+	} else if !env.VertexAllowADC {
+		return nil, types.NewErrorRequest("Vertex service account key is required", 401)
+	}
+
+	key := googleClientKey("vertex", *credential.Project, location, serviceAccount, model)
+	return sharedGoogleClient(key, func() (googleClient, error) {
+		return vertex.New(context.WithoutCancel(ctx), vertexOpts...)
+	})
+}
+
+func newAzureOpenAI(requestID string, ctx context.Context, credential types.RequestChatCredential, model string) (llms.Model, error) {
+	if credential.APIKey == nil {
+		return nil, types.NewErrorRequest("Azure OpenAI API key is required", 401)
+	}
+	if credential.URL == nil {
+		return nil, types.NewErrorRequest("Azure OpenAI endpoint URL is required", 400)
+	}
+
+	// Azure routes requests by deployment name rather than model name
+	deployment := model
+	if credential.Deployment != nil {
+		deployment = *credential.Deployment
+	}
+	apiVersion := defaultAzureAPIVersion
+	if credential.APIVersion != nil {
+		apiVersion = *credential.APIVersion
+	}
+	utils.VerbosePrintf("[%s]   Azure deployment: %s, API version: %s\n", requestID, deployment, apiVersion)
+
+	azureOpts := []openai.Option{
+		openai.WithToken(*credential.APIKey),
+		openai.WithModel(deployment),
+		openai.WithBaseURL(*credential.URL),
+		openai.WithAPIType(openai.APITypeAzure),
+		openai.WithAPIVersion(apiVersion),
+	}
+	if len(credential.Headers) > 0 {
+		azureOpts = append(azureOpts, openai.WithHTTPClient(newHeaderClient(credential.Headers)))
+	}
+
+	return openai.New(azureOpts...)
+}
+
+func newOpenAICompatible(requestID string, ctx context.Context, credential types.RequestChatCredential, model string) (llms.Model, error) {
+	if credential.URL == nil {
+		return nil, types.NewErrorRequest("OpenAI-compatible base URL is required", 400)
+	}
+	if credential.Model == nil {
+		return nil, types.NewErrorRequest("OpenAI-compatible model is required", 400)
+	}
+
+	// Most local servers ignore the token but the client requires one
+	token := "openai_compatible"
+	if credential.APIKey != nil {
+		token = *credential.APIKey
+	}
+	utils.VerbosePrintf("[%s]   OpenAI-compatible BaseURL: %s (%d extra headers)\n", requestID, *credential.URL, len(credential.Headers))
+
+	compatibleOpts := []openai.Option{
+		openai.WithToken(token),
+		openai.WithModel(model),
+		openai.WithBaseURL(*credential.URL),
+	}
+	if len(credential.Headers) > 0 {
+		compatibleOpts = append(compatibleOpts, openai.WithHTTPClient(newHeaderClient(credential.Headers)))
+	}
+
+	return openai.New(compatibleOpts...)
+}
+
+func newMistral(requestID string, ctx context.Context, credential types.RequestChatCredential, model string) (llms.Model, error) {
+	if credential.APIKey == nil {
+		return nil, types.NewErrorRequest("Mistral API key is required", 401)
+	}
+
+	mistralOpts := []mistral.Option{
+		mistral.WithAPIKey(*credential.APIKey),
+		mistral.WithModel(model),
+	}
+	if credential.URL != nil {
+		mistralOpts = append(mistralOpts, mistral.WithEndpoint(*credential.URL))
+	}
+
+	return mistral.New(mistralOpts...)
+}
+
+func newCohere(requestID string, ctx context.Context, credential types.RequestChatCredential, model string) (llms.Model, error) {
+	if credential.APIKey == nil {
+		return nil, types.NewErrorRequest("Cohere API key is required", 401)
+	}
+
+	cohereOpts := []cohere.Option{
+		cohere.WithToken(*credential.APIKey),
+		cohere.WithModel(model),
+	}
+	if credential.URL != nil {
+		cohereOpts = append(cohereOpts, cohere.WithBaseURL(*credential.URL))
+	}
+
+	return cohere.New(cohereOpts...)
+}
+
+func newBedrock(requestID string, ctx context.Context, credential types.RequestChatCredential, model string) (llms.Model, error) {
+	// AWS credentials come from the server environment; only the region
+	// can be chosen per request
+	if !env.BedrockAllowAmbientCredentials {
+		return nil, types.NewErrorRequest("Bedrock is not enabled on this server", 403)
+	}
+	awsOpts := []func(*config.LoadOptions) error{}
+	if credential.Location != nil {
+		awsOpts = append(awsOpts, config.WithRegion(*credential.Location))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, awsOpts...)
+	if err != nil {
+		return nil, err
+	}
+	utils.VerbosePrintf("[%s]   Bedrock region: %s\n", requestID, cfg.Region)
+
+	return bedrock.New(
+		bedrock.WithModel(model),
+		bedrock.WithClient(bedrockruntime.NewFromConfig(cfg)),
+	)
+}
+
+func newOllama(requestID string, ctx context.Context, credential types.RequestChatCredential, model string) (llms.Model, error) {
+	if credential.URL == nil {
+		return nil, types.NewErrorRequest("Ollama URL is required", 400)
+	}
+
+	return ollama.New(
+		ollama.WithModel(model),
+		ollama.WithServerURL(*credential.URL),
+	)
+}
+
+// llamaCPPTransport skips TLS verification, as llama.cpp servers are often
+// served with self-signed certificates. The tool probe shares it.
+var llamaCPPTransport = &http.Transport{
+	TLSClientConfig: &tls.Config{
+		InsecureSkipVerify: true,
+	},
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 100,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+func newLlamaCPP(requestID string, ctx context.Context, credential types.RequestChatCredential, model string) (llms.Model, error) {
+	if credential.URL == nil {
+		return nil, types.NewErrorRequest("Llama.cpp URL is required", 400)
+	}
+
+	utils.VerbosePrintf("[%s]   Llama.cpp BaseURL: %s\n", requestID, *credential.URL)
+
+	// Create custom HTTP client with longer timeout and TLS skip verify
+	httpClient := &http.Client{
+		Timeout:   300 * time.Second,
+		Transport: llamaCPPTransport,
+	}
+	utils.VerbosePrintf("[%s]   Using custom HTTP client (timeout: 300s, TLS skip verify: true)\n", requestID)
+
+	return openai.New(
+		openai.WithToken("llama_cpp"),
+		openai.WithModel(model),
+		openai.WithBaseURL(*credential.URL),
+		openai.WithHTTPClient(httpClient),
+	)
+}
+
+func newVLLM(requestID string, ctx context.Context, credential types.RequestChatCredential, model string) (llms.Model, error) {
+	if credential.URL == nil {
+		return nil, types.NewErrorRequest("vLLM URL is required", 400)
+	}
+
+	return openai.New(
+		openai.WithToken("vllm"),
+		openai.WithModel(model),
+		openai.WithBaseURL(*credential.URL),
+	)
+}
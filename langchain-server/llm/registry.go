@@ -0,0 +1,123 @@
+package llm
+
+import (
+	"context"
+	"sort"
+
+	"langchain-mcp-api/types"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Capabilities describes what a provider's backend supports. The agent picks
+// native or manual tool calling, streaming and prompt layout from these
+// flags instead of from the provider name.
+type Capabilities struct {
+	NativeTools  bool `json:"native_tools"`
+	Streaming    bool `json:"streaming"`
+	Vision       bool `json:"vision"`
+	JSONMode     bool `json:"json_mode"`
+	Reasoning    bool `json:"reasoning"`
+	SystemPrompt bool `json:"system_prompt"`
+}
+
+// ProviderFactory builds the langchaingo model for a credential.
+type ProviderFactory func(requestID string, ctx context.Context, credential types.RequestChatCredential, model string) (llms.Model, error)
+
+// Provider is one entry of the provider registry.
+type Provider struct {
+	Name           string
+	DefaultModel   string
+	RequiresAPIKey bool
+	RequiresURL    bool
+	// RequiresProject marks providers addressed by a cloud project
+	RequiresProject bool
+	Capabilities    Capabilities
+	Usage           UsageNormalizer
+	New             ProviderFactory
+	// ProbeTools, when set, detects tool calling support per served model
+	ProbeTools ToolProbe
+}
+
+var providers = map[string]*Provider{}
+
+// DefaultModelsLangChain maps each registered provider to its default model.
+var DefaultModelsLangChain = map[string]string{}
+
+// RegisterProvider adds a provider to the registry, replacing any provider
+// with the same name.
+func RegisterProvider(p *Provider) {
+	if p.Usage == nil {
+		p.Usage = normalizeGenericUsage
+	}
+	providers[p.Name] = p
+	DefaultModelsLangChain[p.Name] = p.DefaultModel
+}
+
+// GetProvider looks up a registered provider by name.
+func GetProvider(name string) (*Provider, bool) {
+	p, ok := providers[name]
+	return p, ok
+}
+
+// Providers lists all registered providers sorted by name.
+func Providers() []*Provider {
+	list := make([]*Provider, 0, len(providers))
+	for _, p := range providers {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// adaptRequest reshapes a call for the capabilities of the client's provider:
+// system messages are folded into the first human message when the provider
+// has no system role, and the streaming callback is detached when the
+// provider cannot stream. The detached callback is returned so the caller can
+// deliver the whole answer as a single chunk.
+func (c *LangChainClient) adaptRequest(messages []llms.MessageContent, options []llms.CallOption) ([]llms.MessageContent, []llms.CallOption, func(ctx context.Context, chunk []byte) error) {
+	if !c.Capabilities.SystemPrompt {
+		messages = foldSystemMessages(messages)
+	}
+
+	if c.Capabilities.Streaming {
+		return messages, options, nil
+	}
+	callOpts := llms.CallOptions{}
+	for _, opt := range options {
+		opt(&callOpts)
+	}
+	if callOpts.StreamingFunc == nil {
+		return messages, options, nil
+	}
+	options = append(options, llms.WithStreamingFunc(nil))
+	return messages, options, callOpts.StreamingFunc
+}
+
+// foldSystemMessages prepends the text of every system message to the first
+// human message.
+func foldSystemMessages(messages []llms.MessageContent) []llms.MessageContent {
+	var system []llms.ContentPart
+	folded := make([]llms.MessageContent, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role == llms.ChatMessageTypeSystem {
+			system = append(system, msg.Parts...)
+			continue
+		}
+		folded = append(folded, msg)
+	}
+	if len(system) == 0 {
+		return messages
+	}
+
+	for i, msg := range folded {
+		if msg.Role == llms.ChatMessageTypeHuman {
+			parts := append(append([]llms.ContentPart{}, system...), msg.Parts...)
+			folded[i] = llms.MessageContent{Role: msg.Role, Parts: parts}
+			return folded
+		}
+	}
+	return append([]llms.MessageContent{{Role: llms.ChatMessageTypeHuman, Parts: system}}, folded...)
+}
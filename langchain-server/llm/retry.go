@@ -0,0 +1,228 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"langchain-mcp-api/utils"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+const (
+	defaultMaxRetries = 2
+	baseBackoff       = 500 * time.Millisecond
+	maxBackoff        = 8 * time.Second
+)
+
+// GenerationInfo keys added to the first choice so callers can tell which
+// provider of the fallback chain answered.
+const (
+	GenInfoProvider     = "GatewayProvider"
+	GenInfoModel        = "GatewayModel"
+	GenInfoAttempts     = "GatewayAttempts"
+	GenInfoFallbackUsed = "GatewayFallbackUsed"
+)
+
+var retryablePatterns = []string{
+	"status code: 429",
+	"status code: 5",
+	"rate limit",
+	"too many requests",
+	"overloaded",
+	"internal server error",
+	"bad gateway",
+	"service unavailable",
+	"gateway timeout",
+	"timeout",
+	"connection reset",
+	"connection refused",
+	"unexpected eof",
+}
+
+// isRetryable reports whether err is a transient failure (429, 5xx, timeouts)
+// worth retrying. Errors caused by the caller's context are never retried.
+func isRetryable(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		// The per-attempt timeout expired
+		return true
+	}
+
+	var llmErr *llms.Error
+	if errors.As(err, &llmErr) {
+		switch llmErr.Code {
+		case llms.ErrCodeRateLimit, llms.ErrCodeTimeout, llms.ErrCodeProviderUnavailable:
+			return true
+		case llms.ErrCodeAuthentication, llms.ErrCodeInvalidRequest, llms.ErrCodeQuotaExceeded,
+			llms.ErrCodeContentFilter, llms.ErrCodeTokenLimit, llms.ErrCodeResourceNotFound:
+			return false
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, pattern := range retryablePatterns {
+		if strings.Contains(msg, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the exponential delay before retry number attempt (1-based)
+// with up to 20% jitter.
+func backoff(attempt int) time.Duration {
+	delay := baseBackoff << (attempt - 1)
+	if delay > maxBackoff || delay <= 0 {
+		delay = maxBackoff
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay) / 5))
+	return delay + jitter
+}
+
+func (c *LangChainClient) maxRetries() int {
+	if c.Config != nil && c.Config.MaxRetries != nil && *c.Config.MaxRetries >= 0 {
+		return *c.Config.MaxRetries
+	}
+	return defaultMaxRetries
+}
+
+// timeout is the per-attempt deadline configured with set.timeout (seconds).
+func (c *LangChainClient) timeout() time.Duration {
+	if c.Config != nil && c.Config.Timeout != nil && *c.Config.Timeout > 0 {
+		return time.Duration(*c.Config.Timeout) * time.Second
+	}
+	return 0
+}
+
+// generateWithRetry calls the provider, retrying transient failures with
+// exponential backoff. canRetry is consulted before each retry so streaming
+// calls can stop retrying once chunks have been sent.
+func (c *LangChainClient) generateWithRetry(requestID string, ctx context.Context, messages []llms.MessageContent, canRetry func() bool, options ...llms.CallOption) (*llms.ContentResponse, int, error) {
+	callOpts := c.buildCallOptions()
+	callOpts = append(callOpts, options...)
+	messages, callOpts, streamingFunc := c.adaptRequest(messages, callOpts)
+
+	maxRetries := c.maxRetries()
+	attempt := 0
+	for {
+		attempt++
+
+		attemptCtx := ctx
+		cancel := func() {}
+		if timeout := c.timeout(); timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		result, err := c.LLM.GenerateContent(attemptCtx, messages, callOpts...)
+		cancel()
+
+		if err == nil {
+			if streamingFunc != nil && len(result.Choices) > 0 {
+				if err := streamingFunc(ctx, []byte(result.Choices[0].Content)); err != nil {
+					return nil, attempt, err
+				}
+			}
+			return result, attempt, nil
+		}
+		if attempt > maxRetries || !isRetryable(ctx, err) || (canRetry != nil && !canRetry()) {
+			return nil, attempt, err
+		}
+
+		delay := backoff(attempt)
+		utils.VerbosePrintf("[%s]   🔁 Retrying %s/%s in %s (attempt %d/%d): %v\n", requestID, c.Provider, c.Model, delay, attempt+1, maxRetries+1, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, attempt, ctx.Err()
+		}
+	}
+}
+
+// generateWithFallback runs the call on the primary provider and, when it
+// fails, on each fallback in order. The returned response is annotated with
+// the provider and model that answered.
+func (c *LangChainClient) generateWithFallback(requestID string, ctx context.Context, messages []llms.MessageContent, canRetry func() bool, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	chain := append([]*LangChainClient{c}, c.Fallbacks...)
+
+	var lastErr error
+	for idx, client := range chain {
+		if idx > 0 {
+			if ctx.Err() != nil || (canRetry != nil && !canRetry()) {
+				break
+			}
+			utils.VerbosePrintf("[%s]   ↪️  Falling back to %s/%s\n", requestID, client.Provider, client.Model)
+		}
+
+		result, attempts, err := client.generateWithRetry(requestID, ctx, messages, canRetry, options...)
+		if err != nil {
+			utils.VerbosePrintf("[%s]   ❌ %s/%s failed after %d attempt(s): %v\n", requestID, client.Provider, client.Model, attempts, err)
+			lastErr = err
+			continue
+		}
+		if len(result.Choices) > 0 {
+			if result.Choices[0].GenerationInfo == nil {
+				result.Choices[0].GenerationInfo = map[string]any{}
+			}
+			genInfo := result.Choices[0].GenerationInfo
+			genInfo[GenInfoProvider] = client.Provider
+			genInfo[GenInfoModel] = client.Model
+			genInfo[GenInfoAttempts] = attempts
+			genInfo[GenInfoFallbackUsed] = idx > 0
+		}
+		return result, nil
+	}
+
+	if len(chain) > 1 {
+		return nil, fmt.Errorf("all %d providers failed, last error: %w", len(chain), lastErr)
+	}
+	return nil, lastErr
+}
+
+// AnsweredBy returns the provider and model recorded on a response by the
+// fallback chain, defaulting to the given values.
+func AnsweredBy(result *llms.ContentResponse, provider, model string) (string, string) {
+	if result == nil || len(result.Choices) == 0 || result.Choices[0].GenerationInfo == nil {
+		return provider, model
+	}
+	genInfo := result.Choices[0].GenerationInfo
+	if p, ok := genInfo[GenInfoProvider].(string); ok && p != "" {
+		provider = p
+	}
+	if m, ok := genInfo[GenInfoModel].(string); ok && m != "" {
+		model = m
+	}
+	return provider, model
+}
+
+// resilientModel exposes the retry and fallback chain as an llms.Model, for
+// use by langchaingo agents and chains.
+type resilientModel struct {
+	client    *LangChainClient
+	requestID string
+}
+
+func (m *resilientModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	return m.client.generateWithFallback(m.requestID, ctx, messages, nil, options...)
+}
+
+func (m *resilientModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// ResilientLLM returns an llms.Model that applies the configured timeout,
+// retries and fallbacks to every call.
+func (c *LangChainClient) ResilientLLM(requestID string) llms.Model {
+	return &resilientModel{client: c, requestID: requestID}
+}
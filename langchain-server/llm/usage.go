@@ -0,0 +1,182 @@
+package llm
+
+import (
+	"encoding/json"
+
+	"langchain-mcp-api/types"
+)
+
+// UsageNormalizer maps the GenerationInfo of one backend into UsageMetadata.
+type UsageNormalizer func(genInfo map[string]any) *types.UsageMetadata
+
+// NormalizeUsage returns the token usage reported by a provider, or nil when
+// the generation info carries no token counts.
+func NormalizeUsage(provider string, genInfo map[string]any) *types.UsageMetadata {
+	if genInfo == nil {
+		return nil
+	}
+
+	normalize := normalizeGenericUsage
+	if p, ok := GetProvider(provider); ok {
+		normalize = p.Usage
+	}
+
+	usage := normalize(genInfo)
+	if usage == nil {
+		return nil
+	}
+	return finalizeUsage(usage)
+}
+
+// normalizeOpenAIUsage covers OpenAI and every OpenAI-compatible backend.
+func normalizeOpenAIUsage(genInfo map[string]any) *types.UsageMetadata {
+	return &types.UsageMetadata{
+		InputTokens:                        intValue(genInfo, "PromptTokens", "prompt_tokens"),
+		OutputTokens:                       intValue(genInfo, "CompletionTokens", "completion_tokens"),
+		TotalTokens:                        intValue(genInfo, "TotalTokens", "total_tokens"),
+		PromptCachedTokens:                 intValue(genInfo, "PromptCachedTokens"),
+		PromptAudioTokens:                  intValue(genInfo, "PromptAudioTokens"),
+		CompletionAudioTokens:              intValue(genInfo, "CompletionAudioTokens"),
+		CompletionReasoningTokens:          intValue(genInfo, "CompletionReasoningTokens"),
+		CompletionAcceptedPredictionTokens: intValue(genInfo, "CompletionAcceptedPredictionTokens"),
+		CompletionRejectedPredictionTokens: intValue(genInfo, "CompletionRejectedPredictionTokens"),
+		ReasoningTokens:                    intValue(genInfo, "ReasoningTokens"),
+		ThinkingTokens:                     intValue(genInfo, "ThinkingTokens"),
+	}
+}
+
+// normalizeAnthropicUsage handles Anthropic, whose InputTokens exclude the
+// tokens read from or written to the prompt cache.
+func normalizeAnthropicUsage(genInfo map[string]any) *types.UsageMetadata {
+	cacheRead := intValue(genInfo, "CacheReadInputTokens", "cache_read_input_tokens")
+	cacheCreation := intValue(genInfo, "CacheCreationInputTokens", "cache_creation_input_tokens")
+	input := intValue(genInfo, "InputTokens", "input_tokens") + cacheRead + cacheCreation
+	output := intValue(genInfo, "OutputTokens", "output_tokens")
+
+	return &types.UsageMetadata{
+		InputTokens:        input,
+		OutputTokens:       output,
+		TotalTokens:        input + output,
+		PromptCachedTokens: cacheRead,
+		ThinkingTokens:     intValue(genInfo, "ThinkingTokens"),
+	}
+}
+
+// normalizeOllamaUsage accepts both the langchaingo keys and Ollama's native
+// prompt_eval_count/eval_count.
+func normalizeOllamaUsage(genInfo map[string]any) *types.UsageMetadata {
+	return &types.UsageMetadata{
+		InputTokens:        intValue(genInfo, "PromptTokens", "prompt_eval_count"),
+		OutputTokens:       intValue(genInfo, "CompletionTokens", "eval_count"),
+		TotalTokens:        intValue(genInfo, "TotalTokens"),
+		PromptCachedTokens: intValue(genInfo, "CachedTokens"),
+	}
+}
+
+// normalizeGoogleUsage handles Gemini, whose prompt count already includes
+// cached content tokens.
+func normalizeGoogleUsage(genInfo map[string]any) *types.UsageMetadata {
+	return &types.UsageMetadata{
+		InputTokens:        intValue(genInfo, "PromptTokens", "input_tokens"),
+		OutputTokens:       intValue(genInfo, "CompletionTokens", "output_tokens"),
+		TotalTokens:        intValue(genInfo, "TotalTokens", "total_tokens"),
+		PromptCachedTokens: intValue(genInfo, "CachedTokens"),
+	}
+}
+
+// normalizeGenericUsage probes every known spelling, including a nested
+// "usage" object as reported by Mistral.
+func normalizeGenericUsage(genInfo map[string]any) *types.UsageMetadata {
+	if nested := nestedMap(genInfo["usage"]); nested != nil {
+		merged := map[string]any{}
+		for k, v := range nested {
+			merged[k] = v
+		}
+		for k, v := range genInfo {
+			merged[k] = v
+		}
+		genInfo = merged
+	}
+
+	return &types.UsageMetadata{
+		InputTokens:        intValue(genInfo, "PromptTokens", "InputTokens", "prompt_tokens", "input_tokens", "prompt_eval_count"),
+		OutputTokens:       intValue(genInfo, "CompletionTokens", "OutputTokens", "completion_tokens", "output_tokens", "eval_count"),
+		TotalTokens:        intValue(genInfo, "TotalTokens", "total_tokens"),
+		PromptCachedTokens: intValue(genInfo, "PromptCachedTokens", "CachedTokens", "CacheReadInputTokens"),
+		ReasoningTokens:    intValue(genInfo, "ReasoningTokens"),
+		ThinkingTokens:     intValue(genInfo, "ThinkingTokens"),
+	}
+}
+
+// finalizeUsage fills in the total and the detail blocks, and drops usage
+// that carries no token counts at all.
+func finalizeUsage(usage *types.UsageMetadata) *types.UsageMetadata {
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+	}
+	if usage.TotalTokens == 0 {
+		return nil
+	}
+
+	if usage.PromptCachedTokens > 0 || usage.PromptAudioTokens > 0 {
+		usage.InputTokenDetails = &types.InputTokenDetails{
+			Audio:     usage.PromptAudioTokens,
+			CacheRead: usage.PromptCachedTokens,
+		}
+	}
+	if usage.CompletionAudioTokens > 0 || usage.CompletionReasoningTokens > 0 {
+		usage.OutputTokenDetails = &types.OutputTokenDetails{
+			Audio:     usage.CompletionAudioTokens,
+			Reasoning: usage.CompletionReasoningTokens,
+		}
+	}
+
+	return usage
+}
+
+// intValue returns the first of keys present in genInfo as an int. Backends
+// report counters as int, int32, int64 or float64 (after a JSON round trip).
+func intValue(genInfo map[string]any, keys ...string) int {
+	for _, key := range keys {
+		val, ok := genInfo[key]
+		if !ok || val == nil {
+			continue
+		}
+		switch v := val.(type) {
+		case int:
+			return v
+		case int32:
+			return int(v)
+		case int64:
+			return int(v)
+		case float32:
+			return int(v)
+		case float64:
+			return int(v)
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				return int(n)
+			}
+		}
+	}
+	return 0
+}
+
+// nestedMap converts a nested usage struct or map into a plain map.
+func nestedMap(val any) map[string]any {
+	if val == nil {
+		return nil
+	}
+	if m, ok := val.(map[string]any); ok {
+		return m
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return m
+}
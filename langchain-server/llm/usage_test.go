@@ -0,0 +1,223 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/gage-technologies/mistral-go"
+)
+
+func TestNormalizeUsage(t *testing.T) {
+	tests := []struct {
+		name       string
+		provider   string
+		genInfo    map[string]any
+		input      int
+		output     int
+		total      int
+		cacheRead  int
+		wantNilUse bool
+	}{
+		{
+			name:     "openai",
+			provider: "openai",
+			genInfo: map[string]any{
+				"PromptTokens":       120,
+				"CompletionTokens":   30,
+				"TotalTokens":        150,
+				"PromptCachedTokens": 100,
+				"ReasoningTokens":    0,
+			},
+			input: 120, output: 30, total: 150, cacheRead: 100,
+		},
+		{
+			name:     "anthropic counts cache reads and writes as input",
+			provider: "claude",
+			genInfo: map[string]any{
+				"InputTokens":              20,
+				"OutputTokens":             15,
+				"CacheCreationInputTokens": 5,
+				"CacheReadInputTokens":     80,
+			},
+			input: 105, output: 15, total: 120, cacheRead: 80,
+		},
+		{
+			name:     "google reports int32 counts under both spellings",
+			provider: "gemini",
+			genInfo: map[string]any{
+				"input_tokens":     int32(40),
+				"output_tokens":    int32(10),
+				"total_tokens":     int32(50),
+				"PromptTokens":     int32(40),
+				"CompletionTokens": int32(10),
+				"TotalTokens":      int32(50),
+				"CachedTokens":     int32(25),
+			},
+			input: 40, output: 10, total: 50, cacheRead: 25,
+		},
+		{
+			name:     "vertex",
+			provider: "vertex",
+			genInfo: map[string]any{
+				"input_tokens":  int32(64),
+				"output_tokens": int32(16),
+				"total_tokens":  int32(80),
+			},
+			input: 64, output: 16, total: 80,
+		},
+		{
+			name:     "ollama",
+			provider: "ollama",
+			genInfo: map[string]any{
+				"PromptTokens":     33,
+				"CompletionTokens": 7,
+				"TotalTokens":      40,
+				"ThinkingTokens":   0,
+			},
+			input: 33, output: 7, total: 40,
+		},
+		{
+			name:     "ollama native counters after a JSON round trip",
+			provider: "ollama",
+			genInfo: map[string]any{
+				"prompt_eval_count": float64(12),
+				"eval_count":        float64(8),
+			},
+			input: 12, output: 8, total: 20,
+		},
+		{
+			name:     "bedrock has no total",
+			provider: "bedrock",
+			genInfo: map[string]any{
+				"input_tokens":  200,
+				"output_tokens": 50,
+			},
+			input: 200, output: 50, total: 250,
+		},
+		{
+			name:     "openrouter",
+			provider: "openrouter",
+			genInfo: map[string]any{
+				"PromptTokens":     90,
+				"CompletionTokens": 10,
+				"TotalTokens":      100,
+			},
+			input: 90, output: 10, total: 100,
+		},
+		{
+			name:     "azure openai",
+			provider: "azure_openai",
+			genInfo: map[string]any{
+				"PromptTokens":       300,
+				"CompletionTokens":   45,
+				"TotalTokens":        345,
+				"PromptCachedTokens": 256,
+			},
+			input: 300, output: 45, total: 345, cacheRead: 256,
+		},
+		{
+			name:     "openai compatible",
+			provider: "openai_compatible",
+			genInfo: map[string]any{
+				"PromptTokens":     18,
+				"CompletionTokens": 4,
+				"TotalTokens":      22,
+			},
+			input: 18, output: 4, total: 22,
+		},
+		{
+			name:     "llama.cpp without a total",
+			provider: "llama_cpp",
+			genInfo: map[string]any{
+				"PromptTokens":     25,
+				"CompletionTokens": 5,
+			},
+			input: 25, output: 5, total: 30,
+		},
+		{
+			name:     "vllm",
+			provider: "vllm",
+			genInfo: map[string]any{
+				"PromptTokens":     70,
+				"CompletionTokens": 30,
+				"TotalTokens":      100,
+			},
+			input: 70, output: 30, total: 100,
+		},
+		{
+			name:     "mistral nests its usage",
+			provider: "mistral",
+			genInfo: map[string]any{
+				"created": 1760000000,
+				"model":   "mistral-small-latest",
+				"usage":   mistral.UsageInfo{PromptTokens: 52, CompletionTokens: 13, TotalTokens: 65},
+			},
+			input: 52, output: 13, total: 65,
+		},
+		{
+			name:     "mistral usage as a map",
+			provider: "mistral",
+			genInfo: map[string]any{
+				"usage": map[string]any{"prompt_tokens": float64(8), "completion_tokens": float64(2)},
+			},
+			input: 8, output: 2, total: 10,
+		},
+		{
+			name:       "cohere reports no usage",
+			provider:   "cohere",
+			genInfo:    map[string]any{},
+			wantNilUse: true,
+		},
+		{
+			name:       "missing keys",
+			provider:   "openai",
+			genInfo:    map[string]any{"ThinkingContent": ""},
+			wantNilUse: true,
+		},
+		{
+			name:       "nil generation info",
+			provider:   "claude",
+			genInfo:    nil,
+			wantNilUse: true,
+		},
+	}
+
+	// Every registered provider needs a row, so a new provider without a
+	// matching normalizer fails here
+	covered := map[string]bool{}
+	for _, tt := range tests {
+		if _, ok := GetProvider(tt.provider); !ok {
+			t.Errorf("%s: provider %q is not registered", tt.name, tt.provider)
+		}
+		covered[tt.provider] = true
+	}
+	for _, provider := range Providers() {
+		if !covered[provider.Name] {
+			t.Errorf("provider %q has no usage test", provider.Name)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage := NormalizeUsage(tt.provider, tt.genInfo)
+			if tt.wantNilUse {
+				if usage != nil {
+					t.Fatalf("expected no usage, got %+v", usage)
+				}
+				return
+			}
+			if usage == nil {
+				t.Fatal("expected usage, got nil")
+			}
+			if usage.InputTokens != tt.input || usage.OutputTokens != tt.output || usage.TotalTokens != tt.total {
+				t.Errorf("tokens = %d/%d/%d, want %d/%d/%d",
+					usage.InputTokens, usage.OutputTokens, usage.TotalTokens, tt.input, tt.output, tt.total)
+			}
+			if usage.PromptCachedTokens != tt.cacheRead {
+				t.Errorf("cached tokens = %d, want %d", usage.PromptCachedTokens, tt.cacheRead)
+			}
+			if tt.cacheRead > 0 && (usage.InputTokenDetails == nil || usage.InputTokenDetails.CacheRead != tt.cacheRead) {
+				t.Errorf("input token details = %+v, want cache_read %d", usage.InputTokenDetails, tt.cacheRead)
+			}
+		})
+	}
+}
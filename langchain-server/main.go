@@ -54,6 +54,11 @@ func main() {
 
 	app.Post("/chat", handlers.ChatHandler)
 	app.Post("/chat/stream", handlers.ChatStreamHandler)
+	app.Get("/usage", handlers.UsageHandler)
+	app.Post("/mcp/catalog", handlers.CatalogHandler)
+	app.Get("/mcp/servers", handlers.ServersHandler)
+	app.Post("/mcp/servers", handlers.RegisterServerHandler)
+	app.Delete("/mcp/servers/:alias", handlers.UnregisterServerHandler)
 
 	log.Fatal(app.Listen("0.0.0.0:6000"))
 
@@ -0,0 +1,158 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"langchain-mcp-api/env"
+	"langchain-mcp-api/types"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// secret looks up a server-side secret by the name a request refers to.
+func secret(name string) (string, bool) {
+	value, ok := env.MCPSecrets[strings.ToUpper(name)]
+	return value, ok
+}
+
+// ValidateAuth checks a server's authentication settings, including that
+// the secrets it refers to exist.
+func ValidateAuth(server types.MCPServer) error {
+	if !server.HasAuth() {
+		return nil
+	}
+	if server.Transport == types.TransportStdio {
+		return fmt.Errorf("headers and auth only apply to HTTP servers")
+	}
+	if server.BearerTokenRef != "" && server.OAuth != nil {
+		return fmt.Errorf("use either bearer_token_ref or oauth, not both")
+	}
+	if server.BearerTokenRef != "" {
+		if _, ok := secret(server.BearerTokenRef); !ok {
+			return fmt.Errorf("unknown secret %q", server.BearerTokenRef)
+		}
+	}
+
+	if oauth := server.OAuth; oauth != nil {
+		if oauth.TokenURL == "" || oauth.ClientID == "" {
+			return fmt.Errorf("oauth needs token_url and client_id")
+		}
+		if (oauth.ClientSecret == "") == (oauth.ClientSecretRef == "") {
+			return fmt.Errorf("oauth needs either client_secret or client_secret_ref")
+		}
+		if oauth.ClientSecretRef != "" {
+			if _, ok := secret(oauth.ClientSecretRef); !ok {
+				return fmt.Errorf("unknown secret %q", oauth.ClientSecretRef)
+			}
+		}
+	}
+	return nil
+}
+
+// authHeader returns the headers for an HTTP call to server: its static
+// headers plus an Authorization header from its bearer token reference or
+// OAuth2 client credentials.
+func authHeader(ctx context.Context, server types.MCPServer) (http.Header, error) {
+	header := http.Header{}
+	for key, value := range server.Headers {
+		header.Set(key, value)
+	}
+
+	switch {
+	case server.BearerTokenRef != "":
+		token, ok := secret(server.BearerTokenRef)
+		if !ok {
+			return nil, fmt.Errorf("unknown secret %q", server.BearerTokenRef)
+		}
+		header.Set("Authorization", "Bearer "+token)
+	case server.OAuth != nil:
+		token, err := oauthToken(ctx, server.OAuth, httpClientFor(server))
+		if err != nil {
+			return nil, fmt.Errorf("oauth token request failed: %w", err)
+		}
+		header.Set("Authorization", token.Type()+" "+token.AccessToken)
+	}
+	return header, nil
+}
+
+// tokenSources caches one token source per client, so access tokens are
+// reused until they expire.
+var tokenSources = struct {
+	sync.Mutex
+	byKey *lru[oauth2.TokenSource]
+}{byKey: newLRU[oauth2.TokenSource]()}
+
+// oauthToken fetches tokens through client's transport, so token URLs
+// supplied by clients are subject to the URL policy too.
+func oauthToken(ctx context.Context, config *types.MCPOAuth, client *http.Client) (*oauth2.Token, error) {
+	clientSecret := config.ClientSecret
+	if config.ClientSecretRef != "" {
+		clientSecret, _ = secret(config.ClientSecretRef)
+	}
+
+	// The secret is part of the key so a wrong secret never reuses a token
+	// obtained with the right one
+	key := fingerprint(config.TokenURL, config.ClientID, clientSecret, strings.Join(config.Scopes, " "), fmt.Sprint(client == guardedHTTPClient))
+
+	tokenSources.Lock()
+	source, ok := tokenSources.byKey.get(key)
+	if !ok {
+		cc := &clientcredentials.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: clientSecret,
+			TokenURL:     config.TokenURL,
+			Scopes:       config.Scopes,
+		}
+		// Tokens outlive the request that first fetched them, so the source
+		// gets its own bounded client instead of the request context
+		tokenClient := &http.Client{Transport: client.Transport, CheckRedirect: client.CheckRedirect, Timeout: env.MCPTimeout}
+		source = cc.TokenSource(context.WithValue(context.Background(), oauth2.HTTPClient, tokenClient))
+		tokenSources.byKey.put(key, source)
+	}
+	tokenSources.Unlock()
+
+	type result struct {
+		token *oauth2.Token
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		token, err := source.Token()
+		done <- result{token, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.token, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// serverKey identifies a server and the credentials used for it. Caches and
+// sessions are keyed by it so clients with different credentials never share
+// them.
+func serverKey(server types.MCPServer) string {
+	if !server.HasAuth() {
+		return server.URL
+	}
+	auth, _ := json.Marshal(struct {
+		Headers map[string]string
+		Bearer  string
+		OAuth   *types.MCPOAuth
+	}{server.Headers, server.BearerTokenRef, server.OAuth})
+	return server.URL + "#" + fingerprint(string(auth))
+}
+
+func fingerprint(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
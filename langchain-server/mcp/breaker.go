@@ -0,0 +1,243 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"langchain-mcp-api/env"
+	"langchain-mcp-api/types"
+)
+
+// CircuitOpenError is returned without contacting a server whose circuit
+// breaker is open.
+type CircuitOpenError struct {
+	Server     string // See MCPServer.Name
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	if e.RetryAfter <= 0 {
+		return fmt.Sprintf("server %s is unavailable after repeated failures, its recovery is being checked", e.Server)
+	}
+	return fmt.Sprintf("server %s is unavailable after repeated failures, retry in %s", e.Server, (e.RetryAfter + time.Second - 1).Truncate(time.Second))
+}
+
+// latencySamples is how many recent call latencies are kept per server.
+const latencySamples = 256
+
+// serverHealth is the breaker state and call history of one server.
+type serverHealth struct {
+	server      types.MCPServer
+	state       string
+	consecutive int
+	openedAt    time.Time
+	// probing marks the single call let through while half-open
+	probing   bool
+	calls     int64
+	failures  int64
+	slowCalls int64
+	rejected  int64
+	latencies []time.Duration // ring buffer, next is the oldest once full
+	next      int
+	lastError string
+	lastAt    time.Time
+}
+
+// health tracks the servers the gateway has called, keyed by serverKey.
+// Servers not called for a while are forgotten, along with their state.
+var health = struct {
+	sync.Mutex
+	byKey *lru[*serverHealth]
+}{byKey: newLRU[*serverHealth]()}
+
+// healthOf returns the server's entry, creating it. health must be locked.
+func healthOf(server types.MCPServer) *serverHealth {
+	key := serverKey(server)
+	h, ok := health.byKey.get(key)
+	if !ok {
+		h = &serverHealth{state: types.CircuitClosed}
+		health.byKey.put(key, h)
+	}
+	h.server = server
+	return h
+}
+
+// acquire asks the server's breaker to let a call through. An open circuit
+// rejects calls until env.MCPBreakerCooldown has passed, then lets a single
+// probe through, reported by probe. Every call let through must end with
+// record.
+func acquire(server types.MCPServer) (probe bool, err error) {
+	health.Lock()
+	defer health.Unlock()
+	h := healthOf(server)
+
+	switch h.state {
+	case types.CircuitOpen:
+		if wait := env.MCPBreakerCooldown - time.Since(h.openedAt); wait > 0 {
+			h.rejected++
+			return false, &CircuitOpenError{Server: server.Name(), RetryAfter: wait}
+		}
+		h.state = types.CircuitHalfOpen
+		h.probing = true
+		return true, nil
+	case types.CircuitHalfOpen:
+		if h.probing {
+			h.rejected++
+			return false, &CircuitOpenError{Server: server.Name()}
+		}
+		h.probing = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// record stores the outcome of a call let through by acquire. Failed calls
+// and calls slower than env.MCPBreakerSlowCall count towards opening the
+// circuit; a failed probe reopens it and a good call closes it. Calls that
+// stopped because ctx ended say nothing about the server and are not
+// counted.
+func record(ctx context.Context, server types.MCPServer, latency time.Duration, err error) {
+	health.Lock()
+	defer health.Unlock()
+	h := healthOf(server)
+	h.probing = false
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+
+	h.calls++
+	if len(h.latencies) < latencySamples {
+		h.latencies = append(h.latencies, latency)
+	} else {
+		h.latencies[h.next] = latency
+		h.next = (h.next + 1) % latencySamples
+	}
+
+	slow := env.MCPBreakerSlowCall > 0 && latency > env.MCPBreakerSlowCall
+	if slow {
+		h.slowCalls++
+	}
+	if err != nil {
+		h.failures++
+		h.lastError = redact(server, err.Error())
+		h.lastAt = time.Now()
+	}
+
+	if err == nil && !slow {
+		if h.state != types.CircuitClosed {
+			log.Printf("[MCP] Circuit of %s closed\n", server.URL)
+		}
+		h.state = types.CircuitClosed
+		h.consecutive = 0
+		return
+	}
+
+	h.consecutive++
+	if env.MCPBreakerFailures == 0 {
+		return
+	}
+	if h.state == types.CircuitHalfOpen || (h.state == types.CircuitClosed && h.consecutive >= env.MCPBreakerFailures) {
+		log.Printf("[MCP] Circuit of %s opened after %d failed or slow calls\n", server.URL, h.consecutive)
+		h.state = types.CircuitOpen
+		h.openedAt = time.Now()
+	}
+}
+
+// ServerHealth reports every registered server, by alias. For admins it
+// adds the other servers the gateway has called, by URL, and the URLs of
+// registered servers; those URLs come from clients and are not shown to
+// other clients.
+func ServerHealth(admin bool) []types.ServerHealth {
+	registered := registeredKeys()
+
+	health.Lock()
+	defer health.Unlock()
+
+	report := []types.ServerHealth{}
+	for _, entry := range RegisteredServers() {
+		h, _ := health.byKey.peek(serverKey(entry.MCPServer))
+		item := serverReport(entry.MCPServer, h)
+		item.Tags = entry.Tags
+		if admin {
+			item.URL = entry.URL
+		}
+		report = append(report, item)
+	}
+	if !admin {
+		return report
+	}
+
+	var others []types.ServerHealth
+	health.byKey.each(func(key string, h *serverHealth) {
+		if registered[key] {
+			return
+		}
+		server := h.server
+		// Unregistered since it was called
+		server.Registered = false
+		others = append(others, serverReport(server, h))
+	})
+	sort.SliceStable(others, func(i, j int) bool { return others[i].URL < others[j].URL })
+	return append(report, others...)
+}
+
+// serverReport describes one server; h is nil for a server not called yet.
+// health must be locked.
+func serverReport(server types.MCPServer, h *serverHealth) types.ServerHealth {
+	item := types.ServerHealth{
+		URL:           server.PublicURL(),
+		Alias:         server.Alias,
+		Transport:     server.Transport,
+		Authenticated: server.HasAuth(),
+		State:         types.CircuitClosed,
+	}
+	if item.Transport == "" {
+		item.Transport = types.TransportREST
+	}
+	if h == nil {
+		return item
+	}
+
+	item.State = h.state
+	item.ConsecutiveFailures = h.consecutive
+	item.Calls = h.calls
+	item.Failures = h.failures
+	item.SlowCalls = h.slowCalls
+	item.Rejected = h.rejected
+	item.LastError = h.lastError
+	if !h.lastAt.IsZero() {
+		lastAt := h.lastAt
+		item.LastErrorAt = &lastAt
+	}
+	if h.state == types.CircuitOpen {
+		openUntil := h.openedAt.Add(env.MCPBreakerCooldown)
+		item.OpenUntil = &openUntil
+		// The next call will probe
+		if time.Now().After(openUntil) {
+			item.State = types.CircuitHalfOpen
+		}
+	}
+
+	sorted := append([]time.Duration(nil), h.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	item.LatencyP50Ms = percentile(sorted, 50).Milliseconds()
+	item.LatencyP90Ms = percentile(sorted, 90).Milliseconds()
+	item.LatencyP99Ms = percentile(sorted, 99).Milliseconds()
+	return item
+}
+
+// percentile returns the nearest-rank percentile p of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
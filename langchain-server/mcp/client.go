@@ -0,0 +1,218 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"langchain-mcp-api/env"
+	"langchain-mcp-api/types"
+)
+
+// Client talks to one MCP server over its transport. Each call applies the
+// timeouts configured for the server.
+type Client interface {
+	Health(ctx context.Context) error
+	ListTools(ctx context.Context) ([]types.Tool, error)
+	CallTool(ctx context.Context, name string, args map[string]interface{}) (interface{}, error)
+	ListResources(ctx context.Context) ([]types.Resource, error)
+	ReadResource(ctx context.Context, uri string) ([]types.ResourceContents, error)
+	ListPrompts(ctx context.Context) ([]types.Prompt, error)
+	GetPrompt(ctx context.Context, name string, args map[string]string) ([]types.PromptMessage, error)
+}
+
+// ErrUnsupported is returned for resources and prompts on the rest
+// transport, which only knows tools.
+var ErrUnsupported = errors.New("resources and prompts need the mcp-http or stdio transport")
+
+// clientFor returns the client for the server's transport. Transports are
+// validated when the request is received.
+func clientFor(server types.MCPServer) Client {
+	switch server.Transport {
+	case types.TransportMCPHTTP:
+		return &streamableClient{server: server}
+	case types.TransportStdio:
+		return &stdioClient{server: server}
+	default:
+		return &restClient{server: server}
+	}
+}
+
+// ValidateServer checks a server's transport, authentication and tool
+// filter, and holds the URLs of servers supplied by clients to the URL
+// policy.
+func ValidateServer(server types.MCPServer) error {
+	switch server.Transport {
+	case "", types.TransportREST, types.TransportMCPHTTP:
+	case types.TransportStdio:
+		// Commands only come from the server-side config
+		if !HasStdioServer(server.StdioAlias()) {
+			return fmt.Errorf("unknown stdio server")
+		}
+	default:
+		return fmt.Errorf("unsupported transport %q", server.Transport)
+	}
+	// A client picks the URL of its own servers, which would then receive
+	// the secret
+	if !server.Registered && (server.BearerTokenRef != "" || (server.OAuth != nil && server.OAuth.ClientSecretRef != "")) {
+		return fmt.Errorf("invalid auth: secret references are only allowed on registered servers")
+	}
+	if err := ValidateAuth(server); err != nil {
+		return fmt.Errorf("invalid auth: %w", err)
+	}
+	if !server.Registered {
+		if err := checkClientCacheTTLs(server.ToolCacheTTLMs); err != nil {
+			return err
+		}
+	}
+	if !server.Registered && server.Transport != types.TransportStdio {
+		if err := CheckURL(server.URL); err != nil {
+			return err
+		}
+		if server.OAuth != nil {
+			if err := CheckURL(server.OAuth.TokenURL); err != nil {
+				return fmt.Errorf("oauth token_url: %w", err)
+			}
+		}
+	}
+	if err := server.Tools.Validate(); err != nil {
+		return fmt.Errorf("invalid tools filter: %w", err)
+	}
+	return nil
+}
+
+// healthTimeout caps the server timeout at the health check default.
+func healthTimeout(server types.MCPServer) time.Duration {
+	timeout := server.Timeout(env.MCPHealthTimeout)
+	if timeout > env.MCPHealthTimeout {
+		timeout = env.MCPHealthTimeout
+	}
+	return timeout
+}
+
+// restClient speaks the project's REST protocol: GET /health, GET /mcp/tools
+// and POST /mcp/invoke.
+type restClient struct {
+	server types.MCPServer
+}
+
+func (c *restClient) Health(ctx context.Context) error {
+	header, err := authHeader(ctx, c.server)
+	if err != nil {
+		return err
+	}
+
+	resp, cancel, err := doRequest(ctx, c.server, healthTimeout(c.server), http.MethodGet, c.server.URL+"/health", nil, header)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unhealthy (status %d)", resp.StatusCode)
+	}
+	return nil
+}
+
+func (c *restClient) ListTools(ctx context.Context) ([]types.Tool, error) {
+	tools, _, err := c.listToolsSince(ctx, "")
+	return tools, err
+}
+
+// listToolsSince fetches the tool list unless it still matches etag, in
+// which case it returns errNotModified. It also returns the list's ETag.
+func (c *restClient) listToolsSince(ctx context.Context, etag string) ([]types.Tool, string, error) {
+	header, err := authHeader(ctx, c.server)
+	if err != nil {
+		return nil, "", err
+	}
+	if etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+
+	resp, cancel, err := doRequest(ctx, c.server, c.server.Timeout(env.MCPTimeout), http.MethodGet, c.server.URL+"/mcp/tools", nil, header)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, etag, errNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to fetch tools: %s", resp.Status)
+	}
+
+	var tools []types.Tool
+	if err := json.NewDecoder(resp.Body).Decode(&tools); err != nil {
+		return nil, "", err
+	}
+
+	return tools, resp.Header.Get("ETag"), nil
+}
+
+func (c *restClient) CallTool(ctx context.Context, name string, args map[string]interface{}) (interface{}, error) {
+	reqBody := types.ToolInvokeRequest{
+		Name:      name,
+		Arguments: args,
+	}
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := authHeader(ctx, c.server)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := c.server.ToolTimeout(name, env.MCPTimeout)
+	resp, cancel, err := doRequest(ctx, c.server, timeout, http.MethodPost, c.server.URL+"/mcp/invoke", bytes.NewBuffer(body), header)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("tool invocation failed: %s - %s", resp.Status, string(bodyBytes))
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(bodyBytes, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (c *restClient) ListResources(ctx context.Context) ([]types.Resource, error) {
+	return nil, ErrUnsupported
+}
+
+func (c *restClient) ReadResource(ctx context.Context, uri string) ([]types.ResourceContents, error) {
+	return nil, ErrUnsupported
+}
+
+func (c *restClient) ListPrompts(ctx context.Context) ([]types.Prompt, error) {
+	return nil, ErrUnsupported
+}
+
+func (c *restClient) GetPrompt(ctx context.Context, name string, args map[string]string) ([]types.PromptMessage, error) {
+	return nil, ErrUnsupported
+}
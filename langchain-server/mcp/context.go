@@ -0,0 +1,140 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"langchain-mcp-api/types"
+	"langchain-mcp-api/utils"
+)
+
+// findServer returns the server of the list with the given name, see
+// MCPServer.Name.
+func findServer(servers []types.MCPServer, name string) (types.MCPServer, bool) {
+	for _, server := range servers {
+		if server.Name() == name {
+			return server, true
+		}
+	}
+	return types.MCPServer{}, false
+}
+
+// ReadResources reads the referenced resources from the available servers
+// and returns them as content parts to attach to the user turn.
+func ReadResources(requestID string, ctx context.Context, servers []types.MCPServer, refs []types.ResourceRef) ([]types.ContentPart, error) {
+	var parts []types.ContentPart
+
+	for _, ref := range refs {
+		server, ok := findServer(servers, ref.Server)
+		if !ok {
+			return nil, fmt.Errorf("server %s is not available", ref.Server)
+		}
+
+		utils.VerbosePrintf("[%s]📄 [MCP] Reading resource %s from %s\n", requestID, ref.URI, ref.Server)
+		contents, err := clientFor(server).ReadResource(ctx, ref.URI)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read resource %s: %w", ref.URI, redactErr(server, err))
+		}
+		for _, content := range contents {
+			parts = append(parts, resourcePart(content))
+		}
+	}
+	return parts, nil
+}
+
+// resourcePart converts resource contents to a content part. Text becomes a
+// text part headed by the URI, image blobs image parts and text blobs file
+// parts. Other binary contents cannot be passed to the LLM and are replaced
+// by a note.
+func resourcePart(content types.ResourceContents) types.ContentPart {
+	switch {
+	case content.Blob == "":
+		return types.ContentPart{Type: types.ContentText, Text: fmt.Sprintf("Resource %s:\n%s", content.URI, content.Text)}
+	case strings.HasPrefix(content.MimeType, "image/"):
+		return types.ContentPart{Type: types.ContentImage, Data: content.Blob, MimeType: content.MimeType}
+	case types.IsTextMimeType(content.MimeType):
+		return types.ContentPart{Type: types.ContentFile, Data: content.Blob, MimeType: content.MimeType, Name: content.URI}
+	default:
+		return types.ContentPart{Type: types.ContentText, Text: fmt.Sprintf("[Resource %s (%s) omitted: binary content]", content.URI, content.MimeType)}
+	}
+}
+
+// GetPrompt expands a server prompt into conversation messages.
+func GetPrompt(requestID string, ctx context.Context, servers []types.MCPServer, ref types.PromptRef) ([]types.Message, error) {
+	server, ok := findServer(servers, ref.Server)
+	if !ok {
+		return nil, fmt.Errorf("server %s is not available", ref.Server)
+	}
+
+	utils.VerbosePrintf("[%s]💬 [MCP] Getting prompt %s from %s\n", requestID, ref.Name, ref.Server)
+	promptMessages, err := clientFor(server).GetPrompt(ctx, ref.Name, ref.Arguments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prompt %s: %w", ref.Name, redactErr(server, err))
+	}
+
+	messages := make([]types.Message, 0, len(promptMessages))
+	for _, pm := range promptMessages {
+		var part types.ContentPart
+		switch pm.Content.Type {
+		case types.ToolContentText:
+			part = types.ContentPart{Type: types.ContentText, Text: pm.Content.Text}
+		case types.ToolContentImage:
+			part = types.ContentPart{Type: types.ContentImage, Data: pm.Content.Data, MimeType: pm.Content.MimeType}
+		case "resource":
+			if pm.Content.Resource == nil {
+				continue
+			}
+			part = resourcePart(*pm.Content.Resource)
+		default:
+			utils.VerbosePrintf("[%s]      Skipping unsupported prompt content %q\n", requestID, pm.Content.Type)
+			continue
+		}
+
+		msg := types.Message{Role: pm.Role}
+		if part.Type == types.ContentText {
+			msg.Content = part.Text
+		} else {
+			msg.Parts = []types.ContentPart{part}
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// Catalog lists the resources and prompts of each server. A server without
+// one of the capabilities lists it as empty; other failures are reported per
+// server.
+func Catalog(requestID string, ctx context.Context, servers []types.MCPServer) []types.ServerCatalog {
+	catalogs := make([]types.ServerCatalog, 0, len(servers))
+
+	for _, server := range servers {
+		catalog := types.ServerCatalog{URL: server.PublicURL(), Alias: server.Alias, Resources: []types.Resource{}, Prompts: []types.Prompt{}}
+		client := clientFor(server)
+
+		resources, err := client.ListResources(ctx)
+		if err == nil || isMethodNotFound(err) {
+			var prompts []types.Prompt
+			prompts, err = client.ListPrompts(ctx)
+			if isMethodNotFound(err) {
+				err = nil
+			}
+			catalog.Resources = append(catalog.Resources, resources...)
+			catalog.Prompts = append(catalog.Prompts, prompts...)
+		}
+		if err != nil {
+			utils.VerbosePrintf("[%s]      ❌ Catalog of %s failed: %v\n", requestID, server.URL, err)
+			catalog.Error = redact(server, err.Error())
+		}
+		catalogs = append(catalogs, catalog)
+	}
+	return catalogs
+}
+
+// isMethodNotFound reports a JSON-RPC "method not found" error, returned by
+// servers without the resources or prompts capability.
+func isMethodNotFound(err error) bool {
+	var rpcErr *rpcError
+	return errors.As(err, &rpcErr) && rpcErr.Code == -32601
+}
@@ -0,0 +1,87 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"langchain-mcp-api/types"
+)
+
+// httpClient calls registered servers and their OAuth token endpoints. It
+// has no global timeout; each call is bounded by its context instead, so
+// per-server and per-tool timeouts can differ.
+var httpClient = &http.Client{
+	Transport: newTransport(http.ProxyFromEnvironment, (&net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext),
+}
+
+// guardedHTTPClient calls servers whose URL a client supplied. Every
+// address it connects to, also after a redirect, passes the URL policy. It
+// never uses a proxy, which would connect on its behalf.
+var guardedHTTPClient = &http.Client{
+	Transport: newTransport(nil, guardedDial(&net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	})),
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return CheckURL(req.URL.String())
+	},
+}
+
+func newTransport(proxy func(*http.Request) (*url.URL, error), dial func(ctx context.Context, network, addr string) (net.Conn, error)) *http.Transport {
+	return &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dial,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 60 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// httpClientFor returns the client for calls to server: registered servers
+// are trusted, servers named by clients go through the URL policy.
+func httpClientFor(server types.MCPServer) *http.Client {
+	if server.Registered {
+		return httpClient
+	}
+	return guardedHTTPClient
+}
+
+// doRequest sends a request bounded by timeout, with optional extra headers.
+// The returned cancel func must be called once the response body has been
+// consumed.
+func doRequest(ctx context.Context, server types.MCPServer, timeout time.Duration, method, url string, body io.Reader, header http.Header) (*http.Response, context.CancelFunc, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+
+	req, err := http.NewRequestWithContext(reqCtx, method, url, body)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := httpClientFor(server).Do(req)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return resp, cancel, nil
+}
@@ -1,13 +1,14 @@
 package mcp
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"sync"
+	"time"
 
+	"langchain-mcp-api/env"
 	"langchain-mcp-api/types"
 	"langchain-mcp-api/utils"
 
@@ -17,7 +18,7 @@ import (
 type MCPTool struct {
 	name        string
 	description string
-	mcpURL      string
+	server      types.MCPServer
 	toolDef     types.Tool
 }
 
@@ -29,13 +30,18 @@ func (t *MCPTool) Description() string {
 	return t.description
 }
 
+// Server returns the server offering the tool.
+func (t *MCPTool) Server() types.MCPServer {
+	return t.server
+}
+
 func (t *MCPTool) Call(ctx context.Context, input string) (string, error) {
 	var args map[string]interface{}
 	if err := json.Unmarshal([]byte(input), &args); err != nil {
 		return "", fmt.Errorf("failed to parse input: %w", err)
 	}
 
-	result, err := InvokeTool(t.mcpURL, t.name, args)
+	result, _, err := t.Invoke(ctx, args)
 	if err != nil {
 		return "", err
 	}
@@ -48,26 +54,28 @@ func (t *MCPTool) Call(ctx context.Context, input string) (string, error) {
 	return string(resultJSON), nil
 }
 
-func LoadMCPToolsAsLangChain(requestID string, mcpServers []string) ([]tools.Tool, []types.Tool, error) {
+// LoadMCPToolsAsLangChain wraps the tools found by CheckServers, in server
+// order. Only tools allowed by both the request filter and the server's own
+// filter are kept.
+func LoadMCPToolsAsLangChain(requestID string, discovery *Discovery, filter *types.ToolFilter) ([]tools.Tool, []types.Tool, error) {
 	utils.VerbosePrintf("\n[%s]🔌 [MCP] Loading tools from MCP servers...\n", requestID)
 	var langchainTools []tools.Tool
 	var toolDefs []types.Tool
 
-	for idx, mcpURL := range mcpServers {
-		utils.VerbosePrintf("[%s]   [%d/%d] Fetching from: %s\n", requestID, idx+1, len(mcpServers), mcpURL)
-		serverTools, err := fetchToolsFromServer(mcpURL)
-		if err != nil {
-			utils.VerbosePrintf("      ❌ Failed: %v\n", err)
-			continue
-		}
-		utils.VerbosePrintf("[%s]      ✅ Loaded %d tools\n", requestID, len(serverTools))
+	for idx, server := range discovery.Servers {
+		serverTools := discovery.tools[serverKey(server)]
+		utils.VerbosePrintf("[%s]   [%d/%d] %s: %d tools\n", requestID, idx+1, len(discovery.Servers), server.URL, len(serverTools))
 
 		for _, toolDef := range serverTools {
+			if !filter.Allows(toolDef.Name) || !server.Tools.Allows(toolDef.Name) {
+				utils.VerbosePrintf("[%s]         - %s (filtered out)\n", requestID, toolDef.Name)
+				continue
+			}
 			utils.VerbosePrintf("[%s]         - %s: %s\n", requestID, toolDef.Name, toolDef.Description)
 			mcpTool := &MCPTool{
 				name:        toolDef.Name,
 				description: toolDef.Description,
-				mcpURL:      mcpURL,
+				server:      server,
 				toolDef:     toolDef,
 			}
 			langchainTools = append(langchainTools, mcpTool)
@@ -79,81 +87,137 @@ func LoadMCPToolsAsLangChain(requestID string, mcpServers []string) ([]tools.Too
 	return langchainTools, toolDefs, nil
 }
 
-func fetchToolsFromServer(mcpURL string) ([]types.Tool, error) {
-	resp, err := http.Get(mcpURL + "/mcp/tools")
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+// Invoke calls the tool. Results of cacheable tools are served from the
+// result cache for identical arguments, reported by a non-nil CacheHit.
+func (t *MCPTool) Invoke(ctx context.Context, args map[string]interface{}) (interface{}, *CacheHit, error) {
+	ttl := t.server.ToolCacheTTL(t.toolDef)
+	key, cacheable := resultKey(t.server, t.name, args)
+	cacheable = cacheable && ttl > 0 && env.MCPToolResultCacheSize > 0
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch tools: %s", resp.Status)
+	if cacheable {
+		if result, hit, ok := cachedResult(key); ok {
+			return result, hit, nil
+		}
 	}
 
-	var tools []types.Tool
-	if err := json.NewDecoder(resp.Body).Decode(&tools); err != nil {
-		return nil, err
+	result, err := InvokeTool(ctx, t.server, t.name, args)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	return tools, nil
-}
-
-func InvokeTool(mcpURL string, toolName string, args map[string]interface{}) (interface{}, error) {
-	reqBody := types.ToolInvokeRequest{
-		Name:      toolName,
-		Arguments: args,
+	if cacheable && !failedResult(result) {
+		storeResult(key, result, ttl)
 	}
+	return result, nil, nil
+}
 
-	body, err := json.Marshal(reqBody)
-	if err != nil {
+// InvokeTool calls a tool on the server, failing fast with a
+// CircuitOpenError while the server's circuit breaker is open.
+func InvokeTool(ctx context.Context, server types.MCPServer, toolName string, args map[string]interface{}) (interface{}, error) {
+	if _, err := acquire(server); err != nil {
 		return nil, err
 	}
-
-	resp, err := http.Post(mcpURL+"/mcp/invoke", "application/json", bytes.NewBuffer(body))
+	start := time.Now()
+	result, err := clientFor(server).CallTool(ctx, toolName, args)
+	record(ctx, server, time.Since(start), err)
 	if err != nil {
-		return nil, err
+		forgetServer(server)
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return nil, fmt.Errorf("tool %s timed out after %s", toolName, server.ToolTimeout(toolName, env.MCPTimeout))
+		}
+		return nil, redactErr(server, err)
 	}
-	defer resp.Body.Close()
+	return result, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("tool invocation failed: %s - %s", resp.Status, string(bodyBytes))
-	}
+// Discovery is the outcome of CheckServers: the available servers with their
+// tools, and a status for every requested server, both in request order.
+type Discovery struct {
+	Servers  []types.MCPServer
+	Statuses []types.ServerStatus
+	tools    map[string][]types.Tool
+}
 
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+// CheckServers checks every server and lists its tools concurrently, all
+// within env.MCPDiscoveryTimeout. Known servers are answered from the tool
+// cache. A server is available once both steps succeed.
+func CheckServers(requestID string, ctx context.Context, mcpServers []types.MCPServer) *Discovery {
+	utils.VerbosePrintf("\n[%s]🏥 [MCP] Checking %d servers...\n", requestID, len(mcpServers))
+	discovery := &Discovery{
+		Servers:  []types.MCPServer{},
+		Statuses: make([]types.ServerStatus, len(mcpServers)),
+		tools:    map[string][]types.Tool{},
 	}
+	found := make([][]types.Tool, len(mcpServers))
+
+	ctx, cancel := context.WithTimeout(ctx, env.MCPDiscoveryTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for idx, server := range mcpServers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found[idx], discovery.Statuses[idx] = checkServer(requestID, ctx, server)
+		}()
+	}
+	wg.Wait()
 
-	var result interface{}
-	if err := json.Unmarshal(bodyBytes, &result); err != nil {
-		return nil, err
+	for idx, status := range discovery.Statuses {
+		if !status.Available {
+			utils.VerbosePrintf("[%s]   ❌ %s not available (%dms): %s\n", requestID, mcpServers[idx].URL, status.LatencyMs, status.Error)
+			continue
+		}
+		utils.VerbosePrintf("[%s]   ✅ %s available (%dms, %d tools)\n", requestID, mcpServers[idx].URL, status.LatencyMs, status.ToolCount)
+		discovery.Servers = append(discovery.Servers, mcpServers[idx])
+		discovery.tools[serverKey(mcpServers[idx])] = found[idx]
 	}
 
-	return result, nil
+	utils.VerbosePrintf("\n[%s]✅ [MCP] Available servers: %d/%d\n", requestID, len(discovery.Servers), len(mcpServers))
+	return discovery
 }
 
-func CheckServers(requestID string, mcpServers []string) []string {
-	utils.VerbosePrintf("\n[%s]🏥 [MCP] Checking server health...\n", requestID)
-	var availableServers []string
+func checkServer(requestID string, ctx context.Context, server types.MCPServer) (serverTools []types.Tool, status types.ServerStatus) {
+	status.URL = server.PublicURL()
+	status.Alias = server.Alias
+	start := time.Now()
+	defer func() {
+		status.LatencyMs = time.Since(start).Milliseconds()
+	}()
 
-	for idx, serverURL := range mcpServers {
-		utils.VerbosePrintf("[%s]   [%d/%d] Checking: %s\n", requestID, idx+1, len(mcpServers), serverURL)
-		resp, err := http.Get(serverURL + "/health")
+	probe, err := acquire(server)
+	if err != nil {
+		status.Error = err.Error()
+		return nil, status
+	}
+
+	// A probe of an open circuit always checks the server's health
+	status.Cached = !probe && knownServer(server)
+	if !status.Cached {
+		healthStart := time.Now()
+		err := clientFor(server).Health(ctx)
+		record(ctx, server, time.Since(healthStart), err)
 		if err != nil {
-			utils.VerbosePrintf("[%s]      ❌ Not available: %v\n", requestID, err)
-			continue
+			status.Error = redact(server, discoveryError(ctx, err))
+			return nil, status
 		}
-		defer resp.Body.Close()
+	}
 
-		if resp.StatusCode == http.StatusOK {
-			availableServers = append(availableServers, serverURL)
-			utils.VerbosePrintf("[%s]      ✅ Healthy (status %d)\n", requestID, resp.StatusCode)
-		} else {
-			utils.VerbosePrintf("[%s]      ⚠️  Unhealthy (status %d)\n", requestID, resp.StatusCode)
-		}
+	serverTools, err = cachedTools(requestID, ctx, server)
+	if err != nil {
+		serverTools = nil
+		status.Error = "failed to list tools: " + redact(server, discoveryError(ctx, err))
+		return nil, status
 	}
 
-	utils.VerbosePrintf("\n[%s]✅ [MCP] Available servers: %d/%d\n", requestID, len(availableServers), len(mcpServers))
-	return availableServers
+	status.Available = true
+	status.ToolCount = len(serverTools)
+	return serverTools, status
+}
+
+// discoveryError names the shared deadline when it is what stopped a call.
+func discoveryError(ctx context.Context, err error) string {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Sprintf("discovery deadline of %s exceeded", env.MCPDiscoveryTimeout)
+	}
+	return err.Error()
 }
@@ -0,0 +1,109 @@
+package mcp
+
+import (
+	"container/list"
+	"time"
+
+	"langchain-mcp-api/env"
+)
+
+// lru is a per-server table bounded to env.MCPServerCacheSize entries,
+// evicting the least recently used beyond it. Entries not used for
+// env.MCPServerIdleTTL expire. It is not safe for concurrent use: callers
+// hold the lock of the table they belong to.
+type lru[V any] struct {
+	order *list.List // front is most recently used
+	byKey map[string]*list.Element
+}
+
+type lruEntry[V any] struct {
+	key    string
+	value  V
+	usedAt time.Time
+}
+
+func newLRU[V any]() *lru[V] {
+	return &lru[V]{order: list.New(), byKey: map[string]*list.Element{}}
+}
+
+// get returns the entry for key and marks it used.
+func (c *lru[V]) get(key string) (V, bool) {
+	elem, ok := c.live(key)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	entry := elem.Value.(*lruEntry[V])
+	entry.usedAt = time.Now()
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// peek returns the entry for key without marking it used.
+func (c *lru[V]) peek(key string) (V, bool) {
+	elem, ok := c.live(key)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return elem.Value.(*lruEntry[V]).value, true
+}
+
+// put stores value under key, marks it used and evicts the entries past
+// the size bound or idle for too long.
+func (c *lru[V]) put(key string, value V) {
+	if elem, ok := c.byKey[key]; ok {
+		entry := elem.Value.(*lruEntry[V])
+		entry.value = value
+		entry.usedAt = time.Now()
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.byKey[key] = c.order.PushFront(&lruEntry[V]{key: key, value: value, usedAt: time.Now()})
+
+	for oldest := c.order.Back(); oldest != nil; oldest = c.order.Back() {
+		if c.order.Len() <= env.MCPServerCacheSize && !expired(oldest.Value.(*lruEntry[V]).usedAt) {
+			break
+		}
+		c.removeElement(oldest)
+	}
+}
+
+func (c *lru[V]) remove(key string) {
+	if elem, ok := c.byKey[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// each calls fn for every entry that has not expired, most recently used
+// first.
+func (c *lru[V]) each(fn func(key string, value V)) {
+	for elem := c.order.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*lruEntry[V])
+		if !expired(entry.usedAt) {
+			fn(entry.key, entry.value)
+		}
+	}
+}
+
+// live looks up key, dropping the entry when it has expired.
+func (c *lru[V]) live(key string) (*list.Element, bool) {
+	elem, ok := c.byKey[key]
+	if !ok {
+		return nil, false
+	}
+	if expired(elem.Value.(*lruEntry[V]).usedAt) {
+		c.removeElement(elem)
+		return nil, false
+	}
+	return elem, true
+}
+
+func (c *lru[V]) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.byKey, elem.Value.(*lruEntry[V]).key)
+}
+
+func expired(usedAt time.Time) bool {
+	return time.Since(usedAt) >= env.MCPServerIdleTTL
+}
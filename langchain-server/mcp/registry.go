@@ -0,0 +1,232 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"langchain-mcp-api/env"
+	"langchain-mcp-api/types"
+)
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// registry holds the named servers requests can reference by alias or tag,
+// loaded from env.MCPServersConfig and changed through the admin API.
+// Changes made through the API last until the process restarts.
+var registry = struct {
+	sync.RWMutex
+	byAlias map[string]types.RegisteredServer
+}{byAlias: map[string]types.RegisteredServer{}}
+
+func init() {
+	if env.MCPServersConfig == "" {
+		return
+	}
+	data, err := os.ReadFile(env.MCPServersConfig)
+	if err != nil {
+		log.Printf("Failed to read MCP servers config %s: %v\n", env.MCPServersConfig, err)
+		return
+	}
+	var config struct {
+		Servers []types.RegisteredServer `json:"servers"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		log.Printf("Failed to parse MCP servers config %s: %v\n", env.MCPServersConfig, err)
+		return
+	}
+	for _, entry := range config.Servers {
+		if _, err := Register(entry); err != nil {
+			log.Printf("MCP server %s skipped: %v\n", entry.Alias, err)
+		}
+	}
+	log.Printf("MCP servers config loaded successfully (%d servers)\n", len(registry.byAlias))
+}
+
+// Register adds a server to the registry, replacing the entry with the same
+// alias. It reports whether the alias is new.
+func Register(entry types.RegisteredServer) (bool, error) {
+	if !aliasPattern.MatchString(entry.Alias) {
+		return false, fmt.Errorf("invalid alias %q", entry.Alias)
+	}
+	if entry.URL == "" {
+		return false, fmt.Errorf("missing url")
+	}
+	if entry.Tag != "" {
+		return false, fmt.Errorf("tag references are not allowed in the registry, use tags")
+	}
+	entry.Registered = true
+	if err := ValidateServer(entry.MCPServer); err != nil {
+		return false, err
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	_, exists := registry.byAlias[entry.Alias]
+	registry.byAlias[entry.Alias] = entry
+	return !exists, nil
+}
+
+// Unregister removes a server from the registry. It reports whether the
+// alias was registered.
+func Unregister(alias string) bool {
+	registry.Lock()
+	defer registry.Unlock()
+	_, exists := registry.byAlias[alias]
+	delete(registry.byAlias, alias)
+	return exists
+}
+
+// RegisteredServers lists the registry by alias.
+func RegisteredServers() []types.RegisteredServer {
+	registry.RLock()
+	defer registry.RUnlock()
+	entries := make([]types.RegisteredServer, 0, len(registry.byAlias))
+	for _, entry := range registry.byAlias {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Alias < entries[j].Alias })
+	return entries
+}
+
+// ResolveServers replaces references to registered servers by their entries.
+// An alias references one server and a tag every server carrying it, in
+// alias order. A reference may override the timeouts of the entry, narrow
+// its tool filter and turn result caching off for its tools, but not change
+// where or how the server is reached. Servers given by URL are passed through, and a
+// server referenced twice is kept once.
+func ResolveServers(servers []types.MCPServer) ([]types.MCPServer, error) {
+	var resolved []types.MCPServer
+	seen := map[string]bool{}
+
+	for _, ref := range servers {
+		if ref.Alias == "" && ref.Tag == "" {
+			resolved = append(resolved, ref)
+			continue
+		}
+		if ref.URL != "" || ref.Transport != "" || ref.HasAuth() {
+			return nil, fmt.Errorf("a server referenced by alias or tag takes no url, transport or auth")
+		}
+		if ref.Alias != "" && ref.Tag != "" {
+			return nil, fmt.Errorf("use either alias or tag, not both")
+		}
+		if err := checkClientCacheTTLs(ref.ToolCacheTTLMs); err != nil {
+			return nil, err
+		}
+
+		var entries []types.RegisteredServer
+		if ref.Alias != "" {
+			registry.RLock()
+			entry, ok := registry.byAlias[ref.Alias]
+			registry.RUnlock()
+			if !ok {
+				return nil, fmt.Errorf("unknown server %q", ref.Alias)
+			}
+			entries = append(entries, entry)
+		} else {
+			for _, entry := range RegisteredServers() {
+				if entry.HasTag(ref.Tag) {
+					entries = append(entries, entry)
+				}
+			}
+			if len(entries) == 0 {
+				return nil, fmt.Errorf("no servers tagged %q", ref.Tag)
+			}
+		}
+
+		for _, entry := range entries {
+			if seen[entry.Alias] {
+				continue
+			}
+			seen[entry.Alias] = true
+
+			server := entry.MCPServer
+			if ref.TimeoutMs != nil {
+				server.TimeoutMs = ref.TimeoutMs
+			}
+			if ref.ToolTimeoutsMs != nil {
+				server.ToolTimeoutsMs = ref.ToolTimeoutsMs
+			}
+			if ref.ToolCacheTTLMs != nil {
+				ttls := map[string]int{}
+				for tool, ttl := range entry.ToolCacheTTLMs {
+					ttls[tool] = ttl
+				}
+				for tool, ttl := range ref.ToolCacheTTLMs {
+					ttls[tool] = ttl
+				}
+				server.ToolCacheTTLMs = ttls
+			}
+			// The reference can only narrow the tools the entry offers
+			server.Tools = entry.Tools.Intersect(ref.Tools)
+			resolved = append(resolved, server)
+		}
+	}
+	return resolved, nil
+}
+
+// checkClientCacheTTLs only lets a client turn result caching off. Cached
+// results are shared by every client of a server, so a TTL set by one
+// client would decide what the others are served.
+func checkClientCacheTTLs(ttls map[string]int) error {
+	for tool, ttl := range ttls {
+		if ttl != 0 {
+			return fmt.Errorf("tool_cache_ttl_ms of %s: only 0 is allowed outside the registry", tool)
+		}
+	}
+	return nil
+}
+
+// registeredKeys returns the serverKeys of the registry, to tell registered
+// servers apart from the ones clients named by URL.
+func registeredKeys() map[string]bool {
+	keys := map[string]bool{}
+	for _, entry := range RegisteredServers() {
+		keys[serverKey(entry.MCPServer)] = true
+	}
+	return keys
+}
+
+// redact keeps the URL and host of a registered server out of a message
+// shown to clients, naming the server by its alias instead.
+func redact(server types.MCPServer, msg string) string {
+	if !server.Registered {
+		return msg
+	}
+	msg = strings.ReplaceAll(msg, server.URL, server.Alias)
+	if u, err := url.Parse(server.URL); err == nil && u.Host != "" {
+		msg = strings.ReplaceAll(msg, u.Host, server.Alias)
+		msg = strings.ReplaceAll(msg, u.Hostname(), server.Alias)
+	}
+	return msg
+}
+
+// redactedError is an error of a registered server with its URL redacted.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+func redactErr(server types.MCPServer, err error) error {
+	if err == nil || !server.Registered {
+		return err
+	}
+	if msg := redact(server, err.Error()); msg != err.Error() {
+		return &redactedError{msg: msg, err: err}
+	}
+	return err
+}
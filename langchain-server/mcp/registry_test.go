@@ -0,0 +1,57 @@
+package mcp
+
+import (
+	"testing"
+
+	"langchain-mcp-api/types"
+)
+
+func TestResolveServersNarrowsToolFilter(t *testing.T) {
+	entry := types.RegisteredServer{MCPServer: types.MCPServer{
+		Alias: "filtertest",
+		URL:   "http://127.0.0.1:4050",
+		Tools: &types.ToolFilter{Include: []string{"dns_*"}, Exclude: []string{"dns_delete"}},
+	}}
+	if _, err := Register(entry); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Unregister("filtertest") })
+
+	tests := []struct {
+		name    string
+		filter  *types.ToolFilter
+		allowed map[string]bool
+	}{
+		{
+			name:    "no request filter keeps the entry's",
+			allowed: map[string]bool{"dns_lookup": true, "dns_trace": true, "dns_delete": false, "http_get": false},
+		},
+		{
+			name:    "request include cannot widen the entry",
+			filter:  &types.ToolFilter{Include: []string{"dns_lookup", "dns_delete", "http_get"}},
+			allowed: map[string]bool{"dns_lookup": true, "dns_trace": false, "dns_delete": false, "http_get": false},
+		},
+		{
+			name:    "request exclude narrows the entry",
+			filter:  &types.ToolFilter{Exclude: []string{"dns_trace"}},
+			allowed: map[string]bool{"dns_lookup": true, "dns_trace": false, "dns_delete": false, "http_get": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved, err := ResolveServers([]types.MCPServer{{Alias: "filtertest", Tools: tt.filter}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resolved) != 1 {
+				t.Fatalf("resolved %d servers, want 1", len(resolved))
+			}
+			for name, want := range tt.allowed {
+				if got := resolved[0].Tools.Allows(name); got != want {
+					t.Errorf("Allows(%q) = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
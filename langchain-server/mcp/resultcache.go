@@ -0,0 +1,100 @@
+package mcp
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"langchain-mcp-api/env"
+	"langchain-mcp-api/types"
+)
+
+// CacheHit reports a tool result served from the result cache.
+type CacheHit struct {
+	Age time.Duration
+}
+
+type resultCacheEntry struct {
+	key       string
+	result    interface{}
+	storedAt  time.Time
+	expiresAt time.Time
+}
+
+// resultCache keeps the results of cacheable tools, shared by all requests
+// and evicted least recently used beyond env.MCPToolResultCacheSize.
+var resultCache = struct {
+	sync.Mutex
+	order *list.List // front is most recently used
+	byKey map[string]*list.Element
+}{order: list.New(), byKey: map[string]*list.Element{}}
+
+// resultKey identifies a call by server and credentials, tool and arguments.
+// Arguments are normalized by re-encoding, which sorts object keys.
+func resultKey(server types.MCPServer, toolName string, args map[string]interface{}) (string, bool) {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	normalized, err := json.Marshal(args)
+	if err != nil {
+		return "", false
+	}
+	return serverKey(server) + "\x00" + toolName + "\x00" + string(normalized), true
+}
+
+func cachedResult(key string) (interface{}, *CacheHit, bool) {
+	resultCache.Lock()
+	defer resultCache.Unlock()
+
+	elem, ok := resultCache.byKey[key]
+	if !ok {
+		return nil, nil, false
+	}
+	entry := elem.Value.(*resultCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		resultCache.order.Remove(elem)
+		delete(resultCache.byKey, key)
+		return nil, nil, false
+	}
+	resultCache.order.MoveToFront(elem)
+	return entry.result, &CacheHit{Age: time.Since(entry.storedAt)}, true
+}
+
+func storeResult(key string, result interface{}, ttl time.Duration) {
+	resultCache.Lock()
+	defer resultCache.Unlock()
+
+	now := time.Now()
+	entry := &resultCacheEntry{key: key, result: result, storedAt: now, expiresAt: now.Add(ttl)}
+	if elem, ok := resultCache.byKey[key]; ok {
+		elem.Value = entry
+		resultCache.order.MoveToFront(elem)
+		return
+	}
+	resultCache.byKey[key] = resultCache.order.PushFront(entry)
+	for resultCache.order.Len() > env.MCPToolResultCacheSize {
+		oldest := resultCache.order.Back()
+		resultCache.order.Remove(oldest)
+		delete(resultCache.byKey, oldest.Value.(*resultCacheEntry).key)
+	}
+}
+
+// failedResult reports a result that describes a tool failure, either as an
+// isError envelope or as the REST protocol's result.error. Failures are
+// never cached.
+func failedResult(result interface{}) bool {
+	if toolResult, ok := types.AsToolResult(result); ok {
+		return toolResult.IsError
+	}
+	obj, ok := result.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	inner, ok := obj["result"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, hasError := inner["error"]
+	return hasError
+}
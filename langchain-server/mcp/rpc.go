@@ -0,0 +1,215 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"langchain-mcp-api/types"
+)
+
+const (
+	mcpProtocolVersion = "2025-06-18"
+	// maxToolPages bounds list pagination against misbehaving servers
+	maxToolPages = 100
+)
+
+var rpcID atomic.Int64
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      *int64 `json:"id,omitempty"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+// rpcCaller sends one JSON-RPC request over a transport and decodes its
+// result into out.
+type rpcCaller func(ctx context.Context, timeout time.Duration, method string, params any, out any) error
+
+type initializeResult struct {
+	ProtocolVersion string `json:"protocolVersion"`
+}
+
+func initializeParams() map[string]any {
+	return map[string]any{
+		"protocolVersion": mcpProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "langchain-mcp-api", "version": "1.0.0"},
+	}
+}
+
+type mcpToolDef struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+	// Meta may mark the tool cacheable, as the REST protocol's cache_ttl_ms
+	Meta struct {
+		CacheTTLMs int `json:"cache_ttl_ms"`
+	} `json:"_meta"`
+}
+
+// rpcListTools collects every page of tools/list.
+func rpcListTools(ctx context.Context, timeout time.Duration, call rpcCaller) ([]types.Tool, error) {
+	defs, err := rpcListPages[mcpToolDef](ctx, timeout, call, "tools/list", "tools")
+	if err != nil {
+		return nil, err
+	}
+
+	tools := make([]types.Tool, 0, len(defs))
+	for _, def := range defs {
+		tools = append(tools, types.Tool{
+			Name:        def.Name,
+			Description: def.Description,
+			Parameters:  toToolParameter(def.InputSchema),
+			CacheTTLMs:  def.Meta.CacheTTLMs,
+		})
+	}
+	return tools, nil
+}
+
+// rpcCallTool returns the tools/call result as decoded JSON. It already has
+// the content envelope shape understood by types.AsToolResult.
+func rpcCallTool(ctx context.Context, timeout time.Duration, call rpcCaller, name string, args map[string]interface{}) (interface{}, error) {
+	params := map[string]any{"name": name, "arguments": args}
+
+	var result interface{}
+	if err := call(ctx, timeout, "tools/call", params, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// rpcListPages collects every page of a paginated list method. Each page
+// result holds its items under key.
+func rpcListPages[T any](ctx context.Context, timeout time.Duration, call rpcCaller, method string, key string) ([]T, error) {
+	var items []T
+	cursor := ""
+
+	for page := 0; page < maxToolPages; page++ {
+		var params map[string]any
+		if cursor != "" {
+			params = map[string]any{"cursor": cursor}
+		}
+
+		var result map[string]json.RawMessage
+		if err := call(ctx, timeout, method, params, &result); err != nil {
+			return nil, err
+		}
+		var pageItems []T
+		if raw, ok := result[key]; ok {
+			if err := json.Unmarshal(raw, &pageItems); err != nil {
+				return nil, fmt.Errorf("invalid %s result: %w", method, err)
+			}
+		}
+		items = append(items, pageItems...)
+
+		var next string
+		if raw, ok := result["nextCursor"]; ok {
+			json.Unmarshal(raw, &next)
+		}
+		if next == "" {
+			return items, nil
+		}
+		cursor = next
+	}
+	return nil, fmt.Errorf("%s returned more than %d pages", method, maxToolPages)
+}
+
+func rpcListResources(ctx context.Context, timeout time.Duration, call rpcCaller) ([]types.Resource, error) {
+	return rpcListPages[types.Resource](ctx, timeout, call, "resources/list", "resources")
+}
+
+func rpcReadResource(ctx context.Context, timeout time.Duration, call rpcCaller, uri string) ([]types.ResourceContents, error) {
+	var result struct {
+		Contents []types.ResourceContents `json:"contents"`
+	}
+	if err := call(ctx, timeout, "resources/read", map[string]any{"uri": uri}, &result); err != nil {
+		return nil, err
+	}
+	return result.Contents, nil
+}
+
+func rpcListPrompts(ctx context.Context, timeout time.Duration, call rpcCaller) ([]types.Prompt, error) {
+	return rpcListPages[types.Prompt](ctx, timeout, call, "prompts/list", "prompts")
+}
+
+func rpcGetPrompt(ctx context.Context, timeout time.Duration, call rpcCaller, name string, args map[string]string) ([]types.PromptMessage, error) {
+	params := map[string]any{"name": name}
+	if len(args) > 0 {
+		params["arguments"] = args
+	}
+
+	var result struct {
+		Messages []types.PromptMessage `json:"messages"`
+	}
+	if err := call(ctx, timeout, "prompts/get", params, &result); err != nil {
+		return nil, err
+	}
+	return result.Messages, nil
+}
+
+// toToolParameter converts an MCP inputSchema into the tool parameter shape
+// used by the REST protocol. Union types keep their first non-null type.
+func toToolParameter(schema map[string]any) types.ToolParameter {
+	param := types.ToolParameter{
+		Type:       types.TypeObject,
+		Properties: map[string]types.ToolParameterProperty{},
+		Required:   []string{},
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	for name, raw := range properties {
+		propSchema, _ := raw.(map[string]any)
+		prop := types.ToolParameterProperty{Type: schemaType(propSchema["type"])}
+		if description, ok := propSchema["description"].(string); ok {
+			prop.Description = &description
+		}
+		if enum, ok := propSchema["enum"].([]any); ok {
+			prop.Enum = enum
+		}
+		param.Properties[name] = prop
+	}
+
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			if s, ok := name.(string); ok {
+				param.Required = append(param.Required, s)
+			}
+		}
+	}
+	return param
+}
+
+func schemaType(t any) types.ParameterType {
+	switch t := t.(type) {
+	case string:
+		return types.ParameterType(t)
+	case []any:
+		for _, name := range t {
+			if s, ok := name.(string); ok && s != "null" {
+				return types.ParameterType(s)
+			}
+		}
+	}
+	return types.TypeString
+}
@@ -0,0 +1,497 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"langchain-mcp-api/env"
+	"langchain-mcp-api/types"
+	"langchain-mcp-api/utils"
+)
+
+const (
+	defaultStdioIdleTimeout = 5 * time.Minute
+	// stdioStopGrace is how long a process may take to exit after its stdin
+	// is closed before it is killed
+	stdioStopGrace = 5 * time.Second
+)
+
+// stdioBaseEnv are the variables of the gateway passed on to stdio servers,
+// besides the env of their config. The rest of its environment holds
+// provider keys and secrets.
+var stdioBaseEnv = []string{"PATH", "HOME"}
+
+// StdioServerConfig describes an MCP server launched as a subprocess. These
+// are only read from the server-side MCP_STDIO_CONFIG file; requests can
+// reference them by alias but never supply a command.
+type StdioServerConfig struct {
+	Command       string            `json:"command"`
+	Args          []string          `json:"args,omitempty"`
+	Env           map[string]string `json:"env,omitempty"`
+	Dir           string            `json:"dir,omitempty"`
+	IdleTimeoutMs int               `json:"idle_timeout_ms,omitempty"` // Stop after this long without calls (default 5 minutes)
+}
+
+func (c StdioServerConfig) idleTimeout() time.Duration {
+	if c.IdleTimeoutMs > 0 {
+		return time.Duration(c.IdleTimeoutMs) * time.Millisecond
+	}
+	return defaultStdioIdleTimeout
+}
+
+// stdioConfigs is loaded before any init function runs, so the server
+// registry can validate stdio entries.
+var stdioConfigs = loadStdioConfigs()
+
+func loadStdioConfigs() map[string]StdioServerConfig {
+	configs := map[string]StdioServerConfig{}
+	if env.MCPStdioConfig == "" {
+		return configs
+	}
+	data, err := os.ReadFile(env.MCPStdioConfig)
+	if err != nil {
+		log.Printf("Failed to read MCP stdio config %s: %v\n", env.MCPStdioConfig, err)
+		return configs
+	}
+	var config struct {
+		Servers map[string]StdioServerConfig `json:"servers"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		log.Printf("Failed to parse MCP stdio config %s: %v\n", env.MCPStdioConfig, err)
+		return configs
+	}
+	for alias, server := range config.Servers {
+		if server.Command == "" {
+			log.Printf("MCP stdio server %s has no command, skipped\n", alias)
+			continue
+		}
+		configs[alias] = server
+	}
+	log.Printf("MCP stdio config loaded successfully (%d servers)\n", len(configs))
+	return configs
+}
+
+// HasStdioServer reports whether alias is configured as a stdio server.
+func HasStdioServer(alias string) bool {
+	_, ok := stdioConfigs[alias]
+	return ok
+}
+
+var stdioProcesses = struct {
+	sync.Mutex
+	byAlias map[string]*stdioProcess
+}{byAlias: map[string]*stdioProcess{}}
+
+func getStdioProcess(server types.MCPServer) (*stdioProcess, error) {
+	alias := server.StdioAlias()
+	config, ok := stdioConfigs[alias]
+	if !ok {
+		return nil, fmt.Errorf("unknown stdio server %q", alias)
+	}
+
+	stdioProcesses.Lock()
+	defer stdioProcesses.Unlock()
+	proc, ok := stdioProcesses.byAlias[alias]
+	if !ok {
+		proc = &stdioProcess{alias: alias, key: serverKey(server), config: config}
+		stdioProcesses.byAlias[alias] = proc
+	}
+	return proc, nil
+}
+
+// stdioProcess manages one subprocess speaking newline-delimited JSON-RPC on
+// stdin/stdout. It is started on the first call, started again on the next
+// call after it exits or crashes, and stopped when idle.
+type stdioProcess struct {
+	alias  string
+	key    string // Tool cache key
+	config StdioServerConfig
+
+	// startMu serializes starts so no request is sent before initialize
+	startMu sync.Mutex
+
+	mu       sync.Mutex
+	running  bool
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	exited   chan struct{}
+	pending  map[string]chan *rpcResponse
+	lastUsed time.Time
+	starts   int
+
+	writeMu sync.Mutex
+}
+
+// ensureStarted launches and initializes the process when it is not running.
+func (p *stdioProcess) ensureStarted(ctx context.Context, timeout time.Duration) error {
+	p.startMu.Lock()
+	defer p.startMu.Unlock()
+
+	p.mu.Lock()
+	if p.running {
+		p.lastUsed = time.Now()
+		p.mu.Unlock()
+		return nil
+	}
+
+	cmd := exec.Command(p.config.Command, p.config.Args...)
+	cmd.Dir = p.config.Dir
+	cmd.Env = []string{}
+	for _, key := range stdioBaseEnv {
+		if value, ok := os.LookupEnv(key); ok {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+	for key, value := range p.config.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		p.mu.Unlock()
+		return fmt.Errorf("failed to start stdio server %s: %w", p.alias, err)
+	}
+
+	p.starts++
+	if p.starts > 1 {
+		log.Printf("MCP stdio server %s started again (start #%d)\n", p.alias, p.starts)
+	}
+	p.running = true
+	p.cmd = cmd
+	p.stdin = stdin
+	p.exited = make(chan struct{})
+	p.pending = map[string]chan *rpcResponse{}
+	p.lastUsed = time.Now()
+	exited := p.exited
+	p.mu.Unlock()
+
+	// Wait closes the pipes, so it is only called once both are read to
+	// the end
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		p.readStdout(cmd, stdout)
+	}()
+	go func() {
+		defer readers.Done()
+		p.logStderr(stderr)
+	}()
+	go p.wait(cmd, &readers, exited)
+	go p.stopWhenIdle(exited)
+
+	var result initializeResult
+	if err := p.request(ctx, timeout, "initialize", initializeParams(), &result); err != nil {
+		p.stop()
+		return fmt.Errorf("initialize failed: %w", err)
+	}
+	writeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := p.write(writeCtx, rpcRequest{JSONRPC: "2.0", Method: "notifications/initialized"}); err != nil {
+		p.stop()
+		return fmt.Errorf("initialized notification failed: %w", err)
+	}
+	return nil
+}
+
+// call implements rpcCaller, starting the process on demand.
+func (p *stdioProcess) call(ctx context.Context, timeout time.Duration, method string, params any, out any) error {
+	if err := p.ensureStarted(ctx, timeout); err != nil {
+		return err
+	}
+	return p.request(ctx, timeout, method, params, out)
+}
+
+func (p *stdioProcess) request(ctx context.Context, timeout time.Duration, method string, params any, out any) error {
+	id := rpcID.Add(1)
+	key := strconv.FormatInt(id, 10)
+	replyChan := make(chan *rpcResponse, 1)
+
+	p.mu.Lock()
+	if !p.running {
+		p.mu.Unlock()
+		return fmt.Errorf("stdio server %s is not running", p.alias)
+	}
+	p.pending[key] = replyChan
+	exited := p.exited
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, key)
+		p.lastUsed = time.Now()
+		p.mu.Unlock()
+	}()
+
+	// The timeout covers the write, which blocks while the server is not
+	// reading its stdin
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := p.write(ctx, rpcRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: params}); err != nil {
+		return err
+	}
+
+	select {
+	case msg := <-replyChan:
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if out != nil && len(msg.Result) > 0 {
+			return json.Unmarshal(msg.Result, out)
+		}
+		return nil
+	case <-exited:
+		return fmt.Errorf("stdio server %s exited", p.alias)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// write sends one message, giving up when ctx ends. The write itself goes
+// on in the background until the server reads it or its stdin is closed.
+func (p *stdioProcess) write(ctx context.Context, msg any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	stdin := p.stdin
+	p.mu.Unlock()
+
+	written := make(chan error, 1)
+	go func() {
+		p.writeMu.Lock()
+		defer p.writeMu.Unlock()
+		_, err := stdin.Write(append(data, '\n'))
+		written <- err
+	}()
+
+	select {
+	case err := <-written:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// readStdout routes responses to their waiting requests, passes
+// notifications on and answers pings from the server. Other server requests
+// are rejected. Output that cannot be read, such as a line past
+// maxSSEMessage, kills the process, which fails the pending calls; the next
+// call starts it again.
+func (p *stdioProcess) readStdout(cmd *exec.Cmd, stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxSSEMessage)
+
+	for scanner.Scan() {
+		var msg rpcResponse
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			utils.VerbosePrintf("[stdio:%s] ignoring non JSON-RPC output: %s\n", p.alias, scanner.Text())
+			continue
+		}
+
+		if msg.Method != "" {
+			if len(msg.ID) > 0 {
+				// Not from this goroutine: the server may not read its
+				// stdin while it is blocked writing stdout
+				go p.replyToServer(msg)
+			} else {
+				handleNotification(p.key, msg.Method)
+			}
+			continue
+		}
+
+		p.mu.Lock()
+		replyChan, ok := p.pending[string(msg.ID)]
+		p.mu.Unlock()
+		if ok {
+			replyChan <- &msg
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Printf("MCP stdio server %s output unreadable, killing it: %v\n", p.alias, err)
+		cmd.Process.Kill()
+		io.Copy(io.Discard, stdout)
+	}
+}
+
+func (p *stdioProcess) replyToServer(msg rpcResponse) {
+	reply := map[string]any{"jsonrpc": "2.0", "id": msg.ID}
+	if msg.Method == "ping" {
+		reply["result"] = map[string]any{}
+	} else {
+		reply["error"] = rpcError{Code: -32601, Message: "method not supported by client"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), env.MCPTimeout)
+	defer cancel()
+	if err := p.write(ctx, reply); err != nil {
+		utils.VerbosePrintf("[stdio:%s] reply to %s failed: %v\n", p.alias, msg.Method, err)
+	}
+}
+
+func (p *stdioProcess) logStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		utils.VerbosePrintf("[stdio:%s] %s\n", p.alias, scanner.Text())
+	}
+}
+
+// wait marks the process stopped once it exits and its output has been
+// read, which fails pending requests. The next call starts it again.
+func (p *stdioProcess) wait(cmd *exec.Cmd, readers *sync.WaitGroup, exited chan struct{}) {
+	readers.Wait()
+	err := cmd.Wait()
+
+	p.mu.Lock()
+	p.running = false
+	p.mu.Unlock()
+	close(exited)
+
+	if err != nil {
+		log.Printf("MCP stdio server %s exited: %v\n", p.alias, err)
+	} else {
+		utils.VerbosePrintf("[stdio:%s] exited\n", p.alias)
+	}
+}
+
+// stopWhenIdle stops the process after the configured idle time without
+// calls.
+func (p *stdioProcess) stopWhenIdle(exited chan struct{}) {
+	idle := p.config.idleTimeout()
+	ticker := time.NewTicker(idle / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-exited:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			stop := len(p.pending) == 0 && time.Since(p.lastUsed) >= idle
+			p.mu.Unlock()
+			if stop {
+				utils.VerbosePrintf("[stdio:%s] idle for %s, stopping\n", p.alias, idle)
+				p.stop()
+				return
+			}
+		}
+	}
+}
+
+// stop closes stdin, which asks a well-behaved server to exit, and kills it
+// when it does not within the grace period.
+func (p *stdioProcess) stop() {
+	p.mu.Lock()
+	if !p.running {
+		p.mu.Unlock()
+		return
+	}
+	cmd := p.cmd
+	stdin := p.stdin
+	exited := p.exited
+	p.mu.Unlock()
+
+	stdin.Close()
+	select {
+	case <-exited:
+	case <-time.After(stdioStopGrace):
+		log.Printf("MCP stdio server %s did not exit after stdin was closed, killing it\n", p.alias)
+		cmd.Process.Kill()
+		<-exited
+	}
+}
+
+// stdioClient talks to a configured stdio server.
+type stdioClient struct {
+	server types.MCPServer
+}
+
+func (c *stdioClient) process() (*stdioProcess, error) {
+	return getStdioProcess(c.server)
+}
+
+func (c *stdioClient) Health(ctx context.Context) error {
+	proc, err := c.process()
+	if err != nil {
+		return err
+	}
+	// Starting a server can take longer than a health check; only the ping
+	// itself is bounded by the health timeout
+	if err := proc.ensureStarted(ctx, c.server.Timeout(env.MCPTimeout)); err != nil {
+		return err
+	}
+	return proc.request(ctx, healthTimeout(c.server), "ping", nil, nil)
+}
+
+func (c *stdioClient) ListTools(ctx context.Context) ([]types.Tool, error) {
+	proc, err := c.process()
+	if err != nil {
+		return nil, err
+	}
+	return rpcListTools(ctx, c.server.Timeout(env.MCPTimeout), proc.call)
+}
+
+func (c *stdioClient) CallTool(ctx context.Context, name string, args map[string]interface{}) (interface{}, error) {
+	proc, err := c.process()
+	if err != nil {
+		return nil, err
+	}
+	return rpcCallTool(ctx, c.server.ToolTimeout(name, env.MCPTimeout), proc.call, name, args)
+}
+
+func (c *stdioClient) ListResources(ctx context.Context) ([]types.Resource, error) {
+	proc, err := c.process()
+	if err != nil {
+		return nil, err
+	}
+	return rpcListResources(ctx, c.server.Timeout(env.MCPTimeout), proc.call)
+}
+
+func (c *stdioClient) ReadResource(ctx context.Context, uri string) ([]types.ResourceContents, error) {
+	proc, err := c.process()
+	if err != nil {
+		return nil, err
+	}
+	return rpcReadResource(ctx, c.server.Timeout(env.MCPTimeout), proc.call, uri)
+}
+
+func (c *stdioClient) ListPrompts(ctx context.Context) ([]types.Prompt, error) {
+	proc, err := c.process()
+	if err != nil {
+		return nil, err
+	}
+	return rpcListPrompts(ctx, c.server.Timeout(env.MCPTimeout), proc.call)
+}
+
+func (c *stdioClient) GetPrompt(ctx context.Context, name string, args map[string]string) ([]types.PromptMessage, error) {
+	proc, err := c.process()
+	if err != nil {
+		return nil, err
+	}
+	return rpcGetPrompt(ctx, c.server.Timeout(env.MCPTimeout), proc.call, name, args)
+}
@@ -0,0 +1,306 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"langchain-mcp-api/env"
+	"langchain-mcp-api/types"
+)
+
+// maxSSEMessage is the largest SSE event accepted; tool results may carry
+// base64 images
+const maxSSEMessage = 32 << 20
+
+var errSessionExpired = errors.New("mcp session expired")
+
+// mcpSession is the state negotiated by initialize, shared by all requests
+// to the same server with the same credentials.
+type mcpSession struct {
+	id              string
+	protocolVersion string
+}
+
+// sessionInit is an initialize in flight, which concurrent first calls to
+// the same server wait for instead of opening sessions of their own.
+type sessionInit struct {
+	done    chan struct{}
+	session *mcpSession
+	err     error
+}
+
+// sessions holds the open sessions by serverKey. A session dropped as idle
+// or evicted is initialized again on the next call.
+var sessions = struct {
+	sync.Mutex
+	byKey        *lru[*mcpSession]
+	initializing map[string]*sessionInit
+}{byKey: newLRU[*mcpSession](), initializing: map[string]*sessionInit{}}
+
+// streamableClient speaks MCP JSON-RPC 2.0 over the Streamable HTTP
+// transport: every message is POSTed to the server URL and answered either
+// with a JSON body or with an SSE stream carrying the response.
+type streamableClient struct {
+	server types.MCPServer
+}
+
+func (c *streamableClient) Health(ctx context.Context) error {
+	return c.call(ctx, healthTimeout(c.server), "ping", nil, nil)
+}
+
+func (c *streamableClient) ListTools(ctx context.Context) ([]types.Tool, error) {
+	return rpcListTools(ctx, c.server.Timeout(env.MCPTimeout), c.call)
+}
+
+func (c *streamableClient) CallTool(ctx context.Context, name string, args map[string]interface{}) (interface{}, error) {
+	return rpcCallTool(ctx, c.server.ToolTimeout(name, env.MCPTimeout), c.call, name, args)
+}
+
+func (c *streamableClient) ListResources(ctx context.Context) ([]types.Resource, error) {
+	return rpcListResources(ctx, c.server.Timeout(env.MCPTimeout), c.call)
+}
+
+func (c *streamableClient) ReadResource(ctx context.Context, uri string) ([]types.ResourceContents, error) {
+	return rpcReadResource(ctx, c.server.Timeout(env.MCPTimeout), c.call, uri)
+}
+
+func (c *streamableClient) ListPrompts(ctx context.Context) ([]types.Prompt, error) {
+	return rpcListPrompts(ctx, c.server.Timeout(env.MCPTimeout), c.call)
+}
+
+func (c *streamableClient) GetPrompt(ctx context.Context, name string, args map[string]string) ([]types.PromptMessage, error) {
+	return rpcGetPrompt(ctx, c.server.Timeout(env.MCPTimeout), c.call, name, args)
+}
+
+// call sends a request within the server's session, initializing one first
+// when needed and once more when the server has dropped it.
+func (c *streamableClient) call(ctx context.Context, timeout time.Duration, method string, params any, out any) error {
+	session, err := c.session(ctx, timeout)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.post(ctx, timeout, session, method, params, out)
+	if !errors.Is(err, errSessionExpired) {
+		return err
+	}
+
+	key := serverKey(c.server)
+	sessions.Lock()
+	if current, ok := sessions.byKey.peek(key); ok && current == session {
+		sessions.byKey.remove(key)
+	}
+	sessions.Unlock()
+
+	if session, err = c.session(ctx, timeout); err != nil {
+		return err
+	}
+	_, err = c.post(ctx, timeout, session, method, params, out)
+	return err
+}
+
+// session returns the server's session, initializing it when there is none.
+// Only one initialize runs per server at a time.
+func (c *streamableClient) session(ctx context.Context, timeout time.Duration) (*mcpSession, error) {
+	key := serverKey(c.server)
+	sessions.Lock()
+	if session, ok := sessions.byKey.get(key); ok {
+		sessions.Unlock()
+		return session, nil
+	}
+	if init, ok := sessions.initializing[key]; ok {
+		sessions.Unlock()
+		select {
+		case <-init.done:
+			return init.session, init.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	init := &sessionInit{done: make(chan struct{})}
+	sessions.initializing[key] = init
+	sessions.Unlock()
+
+	init.session, init.err = c.initialize(ctx, timeout)
+
+	sessions.Lock()
+	delete(sessions.initializing, key)
+	if init.err == nil {
+		sessions.byKey.put(key, init.session)
+	}
+	sessions.Unlock()
+	close(init.done)
+	return init.session, init.err
+}
+
+func (c *streamableClient) initialize(ctx context.Context, timeout time.Duration) (*mcpSession, error) {
+	var result initializeResult
+	sessionID, err := c.post(ctx, timeout, nil, "initialize", initializeParams(), &result)
+	if err != nil {
+		return nil, fmt.Errorf("initialize failed: %w", err)
+	}
+
+	session := &mcpSession{id: sessionID, protocolVersion: result.ProtocolVersion}
+	if err := c.notify(ctx, timeout, session, "notifications/initialized"); err != nil {
+		return nil, fmt.Errorf("initialized notification failed: %w", err)
+	}
+	return session, nil
+}
+
+func (c *streamableClient) header(ctx context.Context, session *mcpSession) (http.Header, error) {
+	header, err := authHeader(ctx, c.server)
+	if err != nil {
+		return nil, err
+	}
+	header.Set("Accept", "application/json, text/event-stream")
+	if session != nil {
+		if session.id != "" {
+			header.Set("Mcp-Session-Id", session.id)
+		}
+		if session.protocolVersion != "" {
+			header.Set("MCP-Protocol-Version", session.protocolVersion)
+		}
+	}
+	return header, nil
+}
+
+// post sends one request and decodes its result into out. It returns the
+// session id assigned by the server, if any.
+func (c *streamableClient) post(ctx context.Context, timeout time.Duration, session *mcpSession, method string, params any, out any) (string, error) {
+	id := rpcID.Add(1)
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+	if err != nil {
+		return "", err
+	}
+
+	header, err := c.header(ctx, session)
+	if err != nil {
+		return "", err
+	}
+
+	resp, cancel, err := doRequest(ctx, c.server, timeout, http.MethodPost, c.server.URL, bytes.NewReader(body), header)
+	if err != nil {
+		return "", err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound && session != nil && session.id != "" {
+		return "", errSessionExpired
+	}
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("%s failed: %s - %s", method, resp.Status, string(bodyBytes))
+	}
+
+	var msg *rpcResponse
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		msg, err = readSSEResponse(resp.Body, id, func(method string) {
+			handleNotification(serverKey(c.server), method)
+		})
+	} else {
+		msg = &rpcResponse{}
+		err = json.NewDecoder(resp.Body).Decode(msg)
+	}
+	if err != nil {
+		return "", err
+	}
+	if msg.Error != nil {
+		return "", msg.Error
+	}
+	if out != nil && len(msg.Result) > 0 {
+		if err := json.Unmarshal(msg.Result, out); err != nil {
+			return "", err
+		}
+	}
+	return resp.Header.Get("Mcp-Session-Id"), nil
+}
+
+func (c *streamableClient) notify(ctx context.Context, timeout time.Duration, session *mcpSession, method string) error {
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", Method: method})
+	if err != nil {
+		return err
+	}
+
+	header, err := c.header(ctx, session)
+	if err != nil {
+		return err
+	}
+
+	resp, cancel, err := doRequest(ctx, c.server, timeout, http.MethodPost, c.server.URL, bytes.NewReader(body), header)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s failed: %s", method, resp.Status)
+	}
+	return nil
+}
+
+// readSSEResponse reads SSE events until the response to request id
+// arrives. Notifications sent on the stream are passed to notify; server
+// requests are skipped.
+func readSSEResponse(body io.Reader, id int64, notify func(method string)) (*rpcResponse, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxSSEMessage)
+	wantID := strconv.FormatInt(id, 10)
+
+	// data holds the data lines of the current event, which are joined
+	// with newlines
+	var data []string
+	// dispatch parses the buffered event and reports the matching response
+	dispatch := func() *rpcResponse {
+		defer func() { data = data[:0] }()
+		var msg rpcResponse
+		if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &msg); err != nil {
+			return nil
+		}
+		if msg.Method != "" {
+			if len(msg.ID) == 0 {
+				notify(msg.Method)
+			}
+			return nil
+		}
+		if string(msg.ID) == wantID {
+			return &msg
+		}
+		return nil
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data:") {
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			continue
+		}
+		if line != "" || len(data) == 0 {
+			continue
+		}
+		if msg := dispatch(); msg != nil {
+			return msg, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if msg := dispatch(); msg != nil {
+			return msg, nil
+		}
+	}
+	return nil, fmt.Errorf("stream ended without a response to request %d", id)
+}
@@ -0,0 +1,204 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"langchain-mcp-api/env"
+	"langchain-mcp-api/types"
+	"langchain-mcp-api/utils"
+)
+
+var errNotModified = errors.New("tool list not modified")
+
+// etagLister is implemented by transports that can revalidate a tool list
+// by ETag.
+type etagLister interface {
+	listToolsSince(ctx context.Context, etag string) ([]types.Tool, string, error)
+}
+
+// toolCacheEntry is the last tool list fetched from a server. A healthy
+// entry marks a known server: its tools are served without contacting it
+// and its per-request health check is skipped.
+type toolCacheEntry struct {
+	server     types.MCPServer
+	tools      []types.Tool
+	etag       string
+	fetchedAt  time.Time
+	healthy    bool
+	refreshing bool
+	// changed records a list_changed notification received mid-refresh
+	changed bool
+}
+
+// toolCache is the process-wide tool catalog, keyed by toolCacheKey.
+// Entries older than env.MCPToolsTTL are still served while a background
+// refresh runs.
+var toolCache = struct {
+	sync.Mutex
+	byKey *lru[*toolCacheEntry]
+}{byKey: newLRU[*toolCacheEntry]()}
+
+// registeredSuffix marks the tool cache keys of registered servers.
+const registeredSuffix = "\x00registered"
+
+// toolCacheKey keys the catalog by server URL and credentials (see
+// serverKey) and by whether the server came from the registry, so a client
+// naming a registered server's URL itself is not served the catalog fetched
+// with the registry's credentials.
+func toolCacheKey(server types.MCPServer) string {
+	if server.Registered {
+		return serverKey(server) + registeredSuffix
+	}
+	return serverKey(server)
+}
+
+// cachedTools returns the server's tools from the cache, fetching them when
+// the server is not known yet or its last refresh failed.
+func cachedTools(requestID string, ctx context.Context, server types.MCPServer) ([]types.Tool, error) {
+	if env.MCPToolsTTL == 0 {
+		return clientFor(server).ListTools(ctx)
+	}
+
+	key := toolCacheKey(server)
+	toolCache.Lock()
+	entry, ok := toolCache.byKey.get(key)
+	if ok && entry.healthy {
+		tools := entry.tools
+		if time.Since(entry.fetchedAt) >= env.MCPToolsTTL && !entry.refreshing {
+			entry.refreshing = true
+			entry.server = server
+			go refreshTools(entry)
+		}
+		toolCache.Unlock()
+		utils.VerbosePrintf("[%s]      Using cached tools\n", requestID)
+		return tools, nil
+	}
+
+	var etag string
+	var previous []types.Tool
+	if ok {
+		etag, previous = entry.etag, entry.tools
+	}
+	toolCache.Unlock()
+
+	tools, etag, err := fetchTools(ctx, server, etag)
+	if errors.Is(err, errNotModified) {
+		tools, err = previous, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	toolCache.Lock()
+	toolCache.byKey.put(key, &toolCacheEntry{
+		server:    server,
+		tools:     tools,
+		etag:      etag,
+		fetchedAt: time.Now(),
+		healthy:   true,
+	})
+	toolCache.Unlock()
+	return tools, nil
+}
+
+// fetchTools lists the server's tools, revalidating by ETag when the
+// transport supports it.
+func fetchTools(ctx context.Context, server types.MCPServer, etag string) ([]types.Tool, string, error) {
+	client := clientFor(server)
+	if lister, ok := client.(etagLister); ok {
+		return lister.listToolsSince(ctx, etag)
+	}
+	tools, err := client.ListTools(ctx)
+	return tools, "", err
+}
+
+// refreshTools refetches a cached tool list in the background. A failed
+// refresh marks the server unknown again, so the next request checks its
+// health and fetches synchronously.
+func refreshTools(entry *toolCacheEntry) {
+	toolCache.Lock()
+	server, etag := entry.server, entry.etag
+	toolCache.Unlock()
+
+	tools, etag, err := fetchTools(context.Background(), server, etag)
+
+	toolCache.Lock()
+	defer toolCache.Unlock()
+	entry.refreshing = false
+	switch {
+	case errors.Is(err, errNotModified):
+		entry.fetchedAt = time.Now()
+	case err != nil:
+		utils.VerbosePrintf("[MCP] Tool refresh for %s failed: %v\n", server.URL, err)
+		entry.healthy = false
+		return
+	default:
+		entry.tools = tools
+		entry.etag = etag
+		entry.fetchedAt = time.Now()
+	}
+
+	// The list may have changed after this refresh was sent
+	if entry.changed {
+		entry.changed = false
+		entry.etag = ""
+		entry.refreshing = true
+		go refreshTools(entry)
+	}
+}
+
+// knownServer reports whether the server's tools are cached from a
+// successful fetch, in which case its health check can be skipped.
+func knownServer(server types.MCPServer) bool {
+	if env.MCPToolsTTL == 0 {
+		return false
+	}
+	toolCache.Lock()
+	defer toolCache.Unlock()
+	entry, ok := toolCache.byKey.peek(toolCacheKey(server))
+	return ok && entry.healthy
+}
+
+// forgetServer marks a server unknown after a failed call, so the next
+// request checks it again instead of trusting the cache.
+func forgetServer(server types.MCPServer) {
+	toolCache.Lock()
+	defer toolCache.Unlock()
+	if entry, ok := toolCache.byKey.peek(toolCacheKey(server)); ok {
+		entry.healthy = false
+	}
+}
+
+// handleNotification reacts to notifications a server sends on any
+// transport, identified by its serverKey. A changed tool list is refetched
+// right away, whether the server was reached through the registry or not.
+func handleNotification(key string, method string) {
+	if method != "notifications/tools/list_changed" {
+		return
+	}
+
+	toolCache.Lock()
+	defer toolCache.Unlock()
+	for _, cacheKey := range []string{key, key + registeredSuffix} {
+		if entry, ok := toolCache.byKey.peek(cacheKey); ok && entry.healthy {
+			refreshChanged(entry)
+		}
+	}
+}
+
+// refreshChanged refetches an entry whose list changed, or flags it when a
+// refresh is already running. Callers hold the toolCache lock.
+func refreshChanged(entry *toolCacheEntry) {
+	if entry.refreshing {
+		entry.changed = true
+		return
+	}
+	utils.VerbosePrintf("[MCP] Tool list of %s changed, refreshing\n", entry.server.URL)
+	// Drop the ETag: the server announced a change
+	entry.etag = ""
+	entry.refreshing = true
+	go refreshTools(entry)
+}
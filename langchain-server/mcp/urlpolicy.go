@@ -0,0 +1,154 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+
+	"langchain-mcp-api/env"
+	"langchain-mcp-api/utils"
+)
+
+// URLPolicyError rejects a server URL supplied by a client.
+type URLPolicyError struct {
+	Host   string
+	Reason string
+}
+
+func (e *URLPolicyError) Error() string {
+	return fmt.Sprintf("server address %s is not allowed: %s", e.Host, e.Reason)
+}
+
+// allowedCIDRs are parsed from env.MCPURLAllowedCIDRs.
+var allowedCIDRs = parseCIDRs(env.MCPURLAllowedCIDRs)
+
+func parseCIDRs(values []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, value := range values {
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			log.Printf("Invalid CIDR %q in MCP_URL_ALLOWED_CIDRS, skipped\n", value)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// privateRanges are the ranges private in practice that net.IP.IsPrivate
+// leaves out: "this network", carrier-grade NAT (which includes cloud
+// metadata endpoints such as 100.100.100.200), IETF protocol assignments,
+// benchmarking, NAT64 and the deprecated IPv6 site-local range.
+var privateRanges = parseCIDRs([]string{"0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "64:ff9b::/96", "64:ff9b:1::/48", "fec0::/10"})
+
+// CheckURL applies the URL policy to a client-supplied server URL before
+// any connection: its scheme, and the host when it is a literal address.
+// Hostnames are checked once resolved, when connecting.
+func CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if !utils.Contains(env.MCPURLSchemes, strings.ToLower(u.Scheme)) {
+		return &URLPolicyError{Host: u.Redacted(), Reason: fmt.Sprintf("scheme %q is not allowed", u.Scheme)}
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("invalid url: missing host")
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		return checkIP(u.Hostname(), ip)
+	}
+	return nil
+}
+
+// checkIP decides whether host may be reached at ip. Link-local addresses,
+// which include the cloud metadata endpoints, are always blocked. Loopback
+// and private addresses are blocked unless the host or address is allowed.
+// Allowed hosts and CIDRs, when configured, are the only addresses
+// reachable.
+func checkIP(host string, ip net.IP) error {
+	if ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() || ip.Equal(net.IPv4bcast) {
+		return &URLPolicyError{Host: host, Reason: "link-local, multicast and unspecified addresses are blocked"}
+	}
+
+	allowed := hostAllowed(host) || cidrAllowed(ip)
+	if (len(env.MCPURLAllowedHosts) > 0 || len(allowedCIDRs) > 0) && !allowed {
+		return &URLPolicyError{Host: host, Reason: "not in the allowed hosts or networks"}
+	}
+	if !allowed && isPrivate(ip) {
+		return &URLPolicyError{Host: host, Reason: "private network addresses are blocked"}
+	}
+	return nil
+}
+
+func isPrivate(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() {
+		return true
+	}
+	for _, ipNet := range privateRanges {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func hostAllowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range env.MCPURLAllowedHosts {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func cidrAllowed(ip net.IP) bool {
+	for _, ipNet := range allowedCIDRs {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// guardedDial connects to a client-supplied server. It resolves the host
+// itself and dials only addresses that pass checkIP, so a name cannot be
+// rebound to a blocked address between the check and the connection.
+func guardedDial(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		// Every address must pass, so the result cannot depend on which
+		// one is dialed
+		for _, ip := range ips {
+			if err := checkIP(host, ip.IP); err != nil {
+				return nil, err
+			}
+		}
+
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.IP.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no addresses for %s", host)
+		}
+		return nil, lastErr
+	}
+}
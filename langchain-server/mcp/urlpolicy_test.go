@@ -0,0 +1,148 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"langchain-mcp-api/env"
+)
+
+// withURLPolicy sets the allowed hosts and CIDRs for one test.
+func withURLPolicy(t *testing.T, hosts, cidrs []string) {
+	t.Helper()
+	prevHosts, prevCIDRs := env.MCPURLAllowedHosts, allowedCIDRs
+	env.MCPURLAllowedHosts = hosts
+	allowedCIDRs = parseCIDRs(cidrs)
+	t.Cleanup(func() {
+		env.MCPURLAllowedHosts, allowedCIDRs = prevHosts, prevCIDRs
+	})
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		hosts   []string
+		cidrs   []string
+		blocked bool
+	}{
+		{name: "public address", url: "https://93.184.216.34/mcp"},
+		{name: "hostname is checked when dialing", url: "https://mcp.example.com/mcp"},
+		{name: "scheme not allowed", url: "file:///etc/passwd", blocked: true},
+		{name: "loopback", url: "http://127.0.0.1:8080/mcp", blocked: true},
+		{name: "IPv6 loopback", url: "http://[::1]/mcp", blocked: true},
+		{name: "private", url: "http://10.0.0.5/mcp", blocked: true},
+		{name: "unspecified IPv4", url: "http://0.0.0.0:8080/mcp", blocked: true},
+		{name: "unspecified IPv6", url: "http://[::]/mcp", blocked: true},
+		{name: "this network", url: "http://0.1.2.3/mcp", blocked: true},
+		{name: "link-local metadata", url: "http://169.254.169.254/latest", blocked: true},
+		{name: "IPv6 link-local", url: "http://[fe80::1]/mcp", blocked: true},
+		{name: "carrier-grade NAT metadata", url: "http://100.100.100.200/mcp", blocked: true},
+		{name: "IPv4-mapped loopback", url: "http://[::ffff:127.0.0.1]/mcp", blocked: true},
+		{name: "IPv4-mapped private", url: "http://[::ffff:192.168.1.1]/mcp", blocked: true},
+		{name: "IPv4-mapped link-local", url: "http://[::ffff:169.254.169.254]/mcp", blocked: true},
+		{name: "NAT64 private", url: "http://[64:ff9b::a00:1]/mcp", blocked: true},
+		{name: "broadcast", url: "http://255.255.255.255/mcp", blocked: true},
+		{
+			name:  "private CIDR allowed",
+			url:   "http://10.0.0.5/mcp",
+			cidrs: []string{"10.0.0.0/24"},
+		},
+		{
+			name:  "IPv4-mapped address in an allowed CIDR",
+			url:   "http://[::ffff:10.0.0.5]/mcp",
+			cidrs: []string{"10.0.0.0/24"},
+		},
+		{
+			name:    "private address outside the allowed CIDR",
+			url:     "http://10.0.1.5/mcp",
+			cidrs:   []string{"10.0.0.0/24"},
+			blocked: true,
+		},
+		{
+			name:    "public address outside the allow-list",
+			url:     "https://93.184.216.34/mcp",
+			cidrs:   []string{"10.0.0.0/24"},
+			blocked: true,
+		},
+		{
+			name:    "link-local stays blocked when allowed",
+			url:     "http://169.254.169.254/latest",
+			cidrs:   []string{"169.254.0.0/16"},
+			blocked: true,
+		},
+		{
+			name:  "allowed host pattern",
+			url:   "http://127.0.0.1:8080/mcp",
+			hosts: []string{"127.0.0.*"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withURLPolicy(t, tt.hosts, tt.cidrs)
+			err := CheckURL(tt.url)
+			var policyErr *URLPolicyError
+			if tt.blocked && !errors.As(err, &policyErr) {
+				t.Fatalf("CheckURL(%q) = %v, want a policy error", tt.url, err)
+			}
+			if !tt.blocked && err != nil {
+				t.Fatalf("CheckURL(%q) = %v, want nil", tt.url, err)
+			}
+		})
+	}
+}
+
+func TestGuardedDialChecksResolvedAddresses(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	tests := []struct {
+		name    string
+		hosts   []string
+		cidrs   []string
+		blocked bool
+	}{
+		{name: "name resolving to loopback", blocked: true},
+		{name: "allowed host", hosts: []string{"localhost"}},
+		{name: "allowed CIDR", cidrs: []string{"127.0.0.0/8", "::1/128"}},
+		{name: "resolved address outside the allowed CIDR", cidrs: []string{"10.0.0.0/8"}, blocked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withURLPolicy(t, tt.hosts, tt.cidrs)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			dial := guardedDial(&net.Dialer{})
+			conn, err := dial(ctx, "tcp", net.JoinHostPort("localhost", port))
+			if conn != nil {
+				conn.Close()
+			}
+			var policyErr *URLPolicyError
+			if tt.blocked && !errors.As(err, &policyErr) {
+				t.Fatalf("dial = %v, want a policy error", err)
+			}
+			if !tt.blocked && err != nil {
+				t.Fatalf("dial = %v, want a connection", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package pricing
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"os"
+	"strings"
+
+	"langchain-mcp-api/env"
+	"langchain-mcp-api/types"
+)
+
+// Price is the USD price per one million tokens of a model. CachedInput and
+// Reasoning fall back to Input and Output when left at zero.
+type Price struct {
+	Input       float64 `json:"input"`
+	Output      float64 `json:"output"`
+	CachedInput float64 `json:"cached_input,omitempty"`
+	Reasoning   float64 `json:"reasoning,omitempty"`
+}
+
+// Table maps "provider/model" to a price. A "provider/*" entry prices every
+// model of a provider that has no exact entry.
+type Table map[string]Price
+
+// DefaultTable covers the default models of each provider. Local backends
+// are free.
+var DefaultTable = Table{
+	"openai/gpt-4o-mini":                     {Input: 0.15, Output: 0.60, CachedInput: 0.075},
+	"openai/gpt-4o":                          {Input: 2.50, Output: 10.00, CachedInput: 1.25},
+	"claude/claude-3-5-sonnet-20241022":      {Input: 3.00, Output: 15.00, CachedInput: 0.30},
+	"claude/claude-3-5-haiku-20241022":       {Input: 0.80, Output: 4.00, CachedInput: 0.08},
+	"openrouter/anthropic/claude-3.5-sonnet": {Input: 3.00, Output: 15.00, CachedInput: 0.30},
+	"gemini/gemini-2.0-flash":                {Input: 0.10, Output: 0.40, CachedInput: 0.025},
+	"vertex/gemini-2.0-flash":                {Input: 0.15, Output: 0.60, CachedInput: 0.0375},
+	"mistral/mistral-small-latest":           {Input: 0.20, Output: 0.60},
+	"cohere/command-r":                       {Input: 0.15, Output: 0.60},
+	"ollama/*":                               {},
+	"llama_cpp/*":                            {},
+	"vllm/*":                                 {},
+}
+
+var table Table
+
+func init() {
+	table = Table{}
+	for key, price := range DefaultTable {
+		table[key] = price
+	}
+
+	if env.PricingFile == "" {
+		return
+	}
+	data, err := os.ReadFile(env.PricingFile)
+	if err != nil {
+		log.Printf("Failed to read pricing file %s: %v\n", env.PricingFile, err)
+		return
+	}
+	var custom Table
+	if err := json.Unmarshal(data, &custom); err != nil {
+		log.Printf("Failed to parse pricing file %s: %v\n", env.PricingFile, err)
+		return
+	}
+	for key, price := range custom {
+		table[key] = price
+	}
+	log.Printf("Pricing file loaded successfully (%d entries)\n", len(custom))
+}
+
+// Lookup returns the price of a provider/model pair.
+func Lookup(provider, model string) (Price, bool) {
+	if price, ok := table[provider+"/"+model]; ok {
+		return price, true
+	}
+	if price, ok := table[provider+"/"+strings.ToLower(model)]; ok {
+		return price, true
+	}
+	price, ok := table[provider+"/*"]
+	return price, ok
+}
+
+// Estimate prices the aggregated usage of a request. It returns nil when
+// there is no usage or the model has no price.
+func Estimate(provider, model string, usage *types.UsageMetadata) *types.Cost {
+	if usage == nil {
+		return nil
+	}
+	price, ok := Lookup(provider, model)
+	if !ok {
+		return nil
+	}
+
+	cachedRate := price.CachedInput
+	if cachedRate == 0 {
+		cachedRate = price.Input
+	}
+	reasoningRate := price.Reasoning
+	if reasoningRate == 0 {
+		reasoningRate = price.Output
+	}
+
+	// Cached and reasoning tokens are already included in the input and
+	// output counters, so they are split out rather than added on top.
+	cached := usage.PromptCachedTokens
+	input := usage.InputTokens - cached
+	if input < 0 {
+		input = 0
+	}
+	reasoning := usage.CompletionReasoningTokens
+	output := usage.OutputTokens - reasoning
+	if output < 0 {
+		output = 0
+	}
+
+	cost := &types.Cost{
+		Currency:        "USD",
+		InputCost:       perMillion(input, price.Input),
+		CachedInputCost: perMillion(cached, cachedRate),
+		OutputCost:      perMillion(output, price.Output),
+		ReasoningCost:   perMillion(reasoning, reasoningRate),
+	}
+	cost.TotalCost = round(cost.InputCost + cost.CachedInputCost + cost.OutputCost + cost.ReasoningCost)
+
+	return cost
+}
+
+func perMillion(tokens int, rate float64) float64 {
+	return round(float64(tokens) * rate / 1_000_000)
+}
+
+func round(value float64) float64 {
+	return math.Round(value*1e8) / 1e8
+}
@@ -0,0 +1,89 @@
+package retrieval
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters, the usual defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// tokenize lower-cases text and splits it on anything that is not a letter
+// or digit, so snake_case and kebab-case tool names become words.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// bm25Scores scores every document against the query with Okapi BM25.
+func bm25Scores(query string, docs []string) []float64 {
+	docTerms := make([]map[string]int, len(docs))
+	docLengths := make([]int, len(docs))
+	docFreq := map[string]int{}
+	totalLength := 0
+
+	for i, doc := range docs {
+		tokens := tokenize(doc)
+		docTerms[i] = map[string]int{}
+		for _, token := range tokens {
+			docTerms[i][token]++
+		}
+		for term := range docTerms[i] {
+			docFreq[term]++
+		}
+		docLengths[i] = len(tokens)
+		totalLength += len(tokens)
+	}
+
+	scores := make([]float64, len(docs))
+	if len(docs) == 0 || totalLength == 0 {
+		return scores
+	}
+	avgLength := float64(totalLength) / float64(len(docs))
+	n := float64(len(docs))
+
+	seen := map[string]bool{}
+	for _, term := range tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		df := float64(docFreq[term])
+		if df == 0 {
+			continue
+		}
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for i := range docs {
+			tf := float64(docTerms[i][term])
+			if tf == 0 {
+				continue
+			}
+			norm := tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(docLengths[i])/avgLength))
+			scores[i] += idf * norm
+		}
+	}
+	return scores
+}
+
+// topK returns the indexes of the k highest scores, best first. Ties keep
+// document order so results are deterministic.
+func topK(scores []float64, k int) []int {
+	indexes := make([]int, len(scores))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		return scores[indexes[a]] > scores[indexes[b]]
+	})
+	if k < len(indexes) {
+		indexes = indexes[:k]
+	}
+	return indexes
+}
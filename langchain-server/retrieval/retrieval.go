@@ -0,0 +1,257 @@
+// Package retrieval picks the tools most relevant to a user turn, so large
+// tool catalogs do not have to be sent to the model in full.
+package retrieval
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"langchain-mcp-api/env"
+	"langchain-mcp-api/types"
+
+	"github.com/tmc/langchaingo/llms/ollama"
+)
+
+const (
+	MethodAuto      = "auto"
+	MethodEmbedding = "embedding"
+	MethodBM25      = "bm25"
+)
+
+// Embedder turns texts into vectors. Name identifies the model so cached
+// vectors are never mixed between models.
+type Embedder interface {
+	Name() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+var defaultEmbedder Embedder
+
+func init() {
+	if env.ToolEmbeddingURL == "" {
+		return
+	}
+	embedder, err := NewOllamaEmbedder(env.ToolEmbeddingURL, env.ToolEmbeddingModel)
+	if err != nil {
+		log.Printf("Failed to create tool embedder: %v\n", err)
+		return
+	}
+	defaultEmbedder = embedder
+	log.Printf("Tool retrieval embeddings enabled (%s)\n", embedder.Name())
+}
+
+// SetEmbedder replaces the embedder used for tool retrieval; nil leaves
+// only BM25.
+func SetEmbedder(embedder Embedder) {
+	defaultEmbedder = embedder
+}
+
+// HasEmbedder reports whether embedding retrieval is available.
+func HasEmbedder() bool {
+	return defaultEmbedder != nil
+}
+
+// ollamaEmbedder embeds with a local Ollama embedding model.
+type ollamaEmbedder struct {
+	model string
+	llm   *ollama.LLM
+}
+
+func NewOllamaEmbedder(url string, model string) (Embedder, error) {
+	llm, err := ollama.New(ollama.WithServerURL(url), ollama.WithModel(model))
+	if err != nil {
+		return nil, err
+	}
+	return &ollamaEmbedder{model: model, llm: llm}, nil
+}
+
+func (e *ollamaEmbedder) Name() string {
+	return "ollama/" + e.model
+}
+
+func (e *ollamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return e.llm.CreateEmbedding(ctx, texts)
+}
+
+// vectors caches embeddings by embedder and text, so each tool description
+// is embedded once per process while it stays within
+// env.ToolEmbeddingCacheSize, evicted least recently used.
+var vectors = struct {
+	sync.Mutex
+	order *list.List // front is most recently used
+	byKey map[string]*list.Element
+}{order: list.New(), byKey: map[string]*list.Element{}}
+
+type vectorEntry struct {
+	key    string
+	vector []float32
+}
+
+// cachedVector looks up a vector. vectors must be locked.
+func cachedVector(key string) ([]float32, bool) {
+	elem, ok := vectors.byKey[key]
+	if !ok {
+		return nil, false
+	}
+	vectors.order.MoveToFront(elem)
+	return elem.Value.(*vectorEntry).vector, true
+}
+
+// storeVector caches a vector. vectors must be locked.
+func storeVector(key string, vector []float32) {
+	if elem, ok := vectors.byKey[key]; ok {
+		elem.Value.(*vectorEntry).vector = vector
+		vectors.order.MoveToFront(elem)
+		return
+	}
+	vectors.byKey[key] = vectors.order.PushFront(&vectorEntry{key: key, vector: vector})
+	for vectors.order.Len() > env.ToolEmbeddingCacheSize {
+		oldest := vectors.order.Back()
+		vectors.order.Remove(oldest)
+		delete(vectors.byKey, oldest.Value.(*vectorEntry).key)
+	}
+}
+
+func vectorKey(embedder Embedder, text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return embedder.Name() + ":" + hex.EncodeToString(sum[:])
+}
+
+// embed returns the vectors of texts, embedding only the ones not cached.
+func embed(ctx context.Context, embedder Embedder, texts []string, cache bool) ([][]float32, error) {
+	result := make([][]float32, len(texts))
+	var missing []string
+	var missingIdx []int
+
+	vectors.Lock()
+	for i, text := range texts {
+		if cache {
+			if vector, ok := cachedVector(vectorKey(embedder, text)); ok {
+				result[i] = vector
+				continue
+			}
+		}
+		missing = append(missing, text)
+		missingIdx = append(missingIdx, i)
+	}
+	vectors.Unlock()
+
+	if len(missing) == 0 {
+		return result, nil
+	}
+	embedded, err := embedder.Embed(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	if len(embedded) != len(missing) {
+		return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(embedded), len(missing))
+	}
+
+	vectors.Lock()
+	for j, idx := range missingIdx {
+		result[idx] = embedded[j]
+		if cache {
+			storeVector(vectorKey(embedder, missing[j]), embedded[j])
+		}
+	}
+	vectors.Unlock()
+	return result, nil
+}
+
+// toolText is what a tool is matched on: its name as words, description and
+// parameter names and descriptions.
+func toolText(tool types.Tool) string {
+	parts := []string{strings.NewReplacer("_", " ", "-", " ").Replace(tool.Name), tool.Description}
+
+	names := make([]string, 0, len(tool.Parameters.Properties))
+	for name := range tool.Parameters.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parts = append(parts, name)
+		if description := tool.Parameters.Properties[name].Description; description != nil {
+			parts = append(parts, *description)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Select returns the k tools most relevant to query, best first, and the
+// method that ranked them. Embeddings are used when available and asked
+// for; BM25 is the deterministic fallback, also when embedding fails in
+// auto mode. When embeddings were asked for explicitly their failure is
+// returned instead.
+func Select(ctx context.Context, query string, tools []types.Tool, k int, method string) ([]types.Tool, string, error) {
+	if k >= len(tools) {
+		return tools, "", nil
+	}
+
+	docs := make([]string, len(tools))
+	for i, tool := range tools {
+		docs[i] = toolText(tool)
+	}
+
+	var scores []float64
+	used := MethodBM25
+	var embedErr error
+	if method != MethodBM25 && defaultEmbedder != nil {
+		scores, embedErr = embeddingScores(ctx, defaultEmbedder, query, docs)
+		if embedErr == nil {
+			used = MethodEmbedding
+		} else if method == MethodEmbedding {
+			return nil, MethodEmbedding, embedErr
+		}
+	}
+	if scores == nil {
+		scores = bm25Scores(query, docs)
+	}
+
+	selected := make([]types.Tool, 0, k)
+	for _, idx := range topK(scores, k) {
+		selected = append(selected, tools[idx])
+	}
+	return selected, used, embedErr
+}
+
+func embeddingScores(ctx context.Context, embedder Embedder, query string, docs []string) ([]float64, error) {
+	docVectors, err := embed(ctx, embedder, docs, true)
+	if err != nil {
+		return nil, err
+	}
+	// Queries are one-off, so they are not cached
+	queryVectors, err := embed(ctx, embedder, []string{query}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make([]float64, len(docs))
+	for i, vector := range docVectors {
+		scores[i] = cosine(queryVectors[0], vector)
+	}
+	return scores, nil
+}
+
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
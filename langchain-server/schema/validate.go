@@ -0,0 +1,218 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Validate checks value (as decoded by encoding/json) against a JSON Schema
+// and returns one message per violation. It covers the subset used for
+// structured answers: type, enum, const, properties, required,
+// additionalProperties, items, anyOf/oneOf/allOf and the numeric, string
+// and array bounds.
+func Validate(schema map[string]any, value any) []string {
+	var errs []string
+	validate(schema, value, "$", &errs)
+	return errs
+}
+
+func validate(schema map[string]any, value any, path string, errs *[]string) {
+	if schema == nil {
+		return
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		*errs = append(*errs, fmt.Sprintf("%s: expected %s, got %s", path, typeNames(t), typeOf(value)))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && !containsValue(enum, value) {
+		*errs = append(*errs, fmt.Sprintf("%s: must be one of %s", path, compact(enum)))
+	}
+	if c, ok := schema["const"]; ok && !equal(c, value) {
+		*errs = append(*errs, fmt.Sprintf("%s: must be %s", path, compact(c)))
+	}
+
+	for _, sub := range subSchemas(schema["allOf"]) {
+		validate(sub, value, path, errs)
+	}
+	if anyOf := subSchemas(schema["anyOf"]); len(anyOf) > 0 && countMatches(anyOf, value) == 0 {
+		*errs = append(*errs, fmt.Sprintf("%s: must match at least one schema in anyOf", path))
+	}
+	if oneOf := subSchemas(schema["oneOf"]); len(oneOf) > 0 && countMatches(oneOf, value) != 1 {
+		*errs = append(*errs, fmt.Sprintf("%s: must match exactly one schema in oneOf", path))
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		validateObject(schema, v, path, errs)
+	case []any:
+		validateArray(schema, v, path, errs)
+	case string:
+		length := float64(len([]rune(v)))
+		if min, ok := number(schema["minLength"]); ok && length < min {
+			*errs = append(*errs, fmt.Sprintf("%s: shorter than %v characters", path, min))
+		}
+		if max, ok := number(schema["maxLength"]); ok && length > max {
+			*errs = append(*errs, fmt.Sprintf("%s: longer than %v characters", path, max))
+		}
+	case float64:
+		if min, ok := number(schema["minimum"]); ok && v < min {
+			*errs = append(*errs, fmt.Sprintf("%s: must be >= %v", path, min))
+		}
+		if max, ok := number(schema["maximum"]); ok && v > max {
+			*errs = append(*errs, fmt.Sprintf("%s: must be <= %v", path, max))
+		}
+	}
+}
+
+func validateObject(schema map[string]any, obj map[string]any, path string, errs *[]string) {
+	if required, ok := schema["required"].([]any); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, present := obj[name]; !present {
+				*errs = append(*errs, fmt.Sprintf("%s: missing required property %q", path, name))
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if propSchema, ok := properties[key].(map[string]any); ok {
+			validate(propSchema, obj[key], path+"."+key, errs)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				*errs = append(*errs, fmt.Sprintf("%s: unexpected property %q", path, key))
+			}
+		case map[string]any:
+			validate(additional, obj[key], path+"."+key, errs)
+		}
+	}
+}
+
+func validateArray(schema map[string]any, arr []any, path string, errs *[]string) {
+	if min, ok := number(schema["minItems"]); ok && float64(len(arr)) < min {
+		*errs = append(*errs, fmt.Sprintf("%s: fewer than %v items", path, min))
+	}
+	if max, ok := number(schema["maxItems"]); ok && float64(len(arr)) > max {
+		*errs = append(*errs, fmt.Sprintf("%s: more than %v items", path, max))
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		for i, item := range arr {
+			validate(items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+func countMatches(schemas []map[string]any, value any) int {
+	matches := 0
+	for _, sub := range schemas {
+		if len(Validate(sub, value)) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+func matchesType(t any, value any) bool {
+	switch t := t.(type) {
+	case string:
+		return matchesTypeName(t, value)
+	case []any:
+		for _, name := range t {
+			if s, ok := name.(string); ok && matchesTypeName(s, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesTypeName(name string, value any) bool {
+	switch name {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return typeOf(value) == name
+	}
+}
+
+func typeOf(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func typeNames(t any) string {
+	if list, ok := t.([]any); ok {
+		names := make([]string, 0, len(list))
+		for _, name := range list {
+			names = append(names, fmt.Sprint(name))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func subSchemas(val any) []map[string]any {
+	list, _ := val.([]any)
+	schemas := make([]map[string]any, 0, len(list))
+	for _, item := range list {
+		if sub, ok := item.(map[string]any); ok {
+			schemas = append(schemas, sub)
+		}
+	}
+	return schemas
+}
+
+func number(val any) (float64, bool) {
+	n, ok := val.(float64)
+	return n, ok
+}
+
+func containsValue(list []any, value any) bool {
+	for _, item := range list {
+		if equal(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(a, b any) bool {
+	return compact(a) == compact(b)
+}
+
+func compact(val any) string {
+	data, _ := json.Marshal(val)
+	return string(data)
+}
@@ -0,0 +1,111 @@
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		// want are substrings of the expected violations, in order
+		want []string
+	}{
+		{name: "integer", schema: `{"type":"integer"}`, value: `3`},
+		{name: "integer with a zero fraction", schema: `{"type":"integer"}`, value: `3.0`},
+		{name: "integer rejects a fraction", schema: `{"type":"integer"}`, value: `3.5`, want: []string{"$: expected integer, got number"}},
+		{name: "integer rejects a string", schema: `{"type":"integer"}`, value: `"3"`, want: []string{"expected integer, got string"}},
+		{name: "number accepts a fraction", schema: `{"type":"number"}`, value: `3.5`},
+		{name: "number accepts an integer", schema: `{"type":"number"}`, value: `3`},
+		{name: "type list", schema: `{"type":["string","null"]}`, value: `null`},
+		{name: "type list mismatch", schema: `{"type":["string","null"]}`, value: `1`, want: []string{"expected string or null, got number"}},
+		{name: "integer bounds", schema: `{"type":"integer","minimum":1,"maximum":5}`, value: `6`, want: []string{"must be <= 5"}},
+		{
+			name:   "anyOf matches one",
+			schema: `{"anyOf":[{"type":"string"},{"type":"integer"}]}`,
+			value:  `4`,
+		},
+		{
+			name:   "anyOf matches several",
+			schema: `{"anyOf":[{"type":"number"},{"type":"integer"}]}`,
+			value:  `4`,
+		},
+		{
+			name:   "anyOf matches none",
+			schema: `{"anyOf":[{"type":"string"},{"type":"integer"}]}`,
+			value:  `4.5`,
+			want:   []string{"must match at least one schema in anyOf"},
+		},
+		{
+			name:   "oneOf matches exactly one",
+			schema: `{"oneOf":[{"type":"string"},{"type":"integer"}]}`,
+			value:  `"a"`,
+		},
+		{
+			name:   "oneOf matches two",
+			schema: `{"oneOf":[{"type":"number"},{"type":"integer"}]}`,
+			value:  `4`,
+			want:   []string{"must match exactly one schema in oneOf"},
+		},
+		{
+			name:   "oneOf matches none",
+			schema: `{"oneOf":[{"type":"string"},{"type":"boolean"}]}`,
+			value:  `4`,
+			want:   []string{"must match exactly one schema in oneOf"},
+		},
+		{
+			name:   "oneOf distinguishes objects by required properties",
+			schema: `{"oneOf":[{"type":"object","required":["a"]},{"type":"object","required":["b"]}]}`,
+			value:  `{"a":1}`,
+		},
+		{
+			name:   "additionalProperties allowed by default",
+			schema: `{"type":"object","properties":{"a":{"type":"string"}}}`,
+			value:  `{"a":"x","b":1}`,
+		},
+		{
+			name:   "additionalProperties false",
+			schema: `{"type":"object","properties":{"a":{"type":"string"}},"additionalProperties":false}`,
+			value:  `{"a":"x","b":1,"c":2}`,
+			want:   []string{`$: unexpected property "b"`, `$: unexpected property "c"`},
+		},
+		{
+			name:   "additionalProperties schema",
+			schema: `{"type":"object","properties":{"a":{"type":"string"}},"additionalProperties":{"type":"integer"}}`,
+			value:  `{"a":"x","b":1,"c":"y"}`,
+			want:   []string{"$.c: expected integer, got string"},
+		},
+		{
+			name:   "nested required property",
+			schema: `{"type":"object","properties":{"items":{"type":"array","items":{"type":"object","required":["id"]}}}}`,
+			value:  `{"items":[{"id":1},{}]}`,
+			want:   []string{`$.items[1]: missing required property "id"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema map[string]any
+			if err := json.Unmarshal([]byte(tt.schema), &schema); err != nil {
+				t.Fatalf("invalid schema: %v", err)
+			}
+			var value any
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatalf("invalid value: %v", err)
+			}
+
+			errs := Validate(schema, value)
+			if len(errs) != len(tt.want) {
+				t.Fatalf("Validate() = %q, want %d violations %q", errs, len(tt.want), tt.want)
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(errs[i], want) {
+					t.Errorf("violation %d = %q, want it to contain %q", i, errs[i], want)
+				}
+			}
+		})
+	}
+}
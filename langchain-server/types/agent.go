@@ -1,5 +1,7 @@
 package types
 
+import "encoding/json"
+
 type ToolCall struct {
 	ID   string                 `json:"id"`
 	Name string                 `json:"name"`
@@ -50,36 +52,94 @@ type OutputTokenDetails struct {
 	Reasoning int `json:"reasoning"`
 }
 
+// Cost is the estimated price of a request in USD, derived from the token
+// counters in UsageMetadata and the configured price table.
+type Cost struct {
+	Currency        string  `json:"currency"`
+	InputCost       float64 `json:"input_cost"`
+	CachedInputCost float64 `json:"cached_input_cost,omitempty"`
+	OutputCost      float64 `json:"output_cost"`
+	ReasoningCost   float64 `json:"reasoning_cost,omitempty"`
+	TotalCost       float64 `json:"total_cost"`
+}
+
 type ResponseMetadata struct {
 	FinishReason      string      `json:"finish_reason"`
 	ModelProvider     string      `json:"model_provider"`
 	ModelName         string      `json:"model_name"`
 	Usage             interface{} `json:"usage"`
 	SystemFingerprint string      `json:"system_fingerprint"`
+	Attempts          int         `json:"attempts,omitempty"`
+	FallbackUsed      bool        `json:"fallback_used,omitempty"`
 }
 
 type Message struct {
 	Role       string            `json:"role"`
 	Content    string            `json:"content"`
+	Parts      []ContentPart     `json:"parts,omitempty"`
 	ToolCalls  []ToolCall        `json:"tool_calls,omitempty"`
 	ToolCallID string            `json:"tool_call_id,omitempty"`
 	Name       string            `json:"name,omitempty"`
 	ID         string            `json:"id,omitempty"`
 	Metadata   *ResponseMetadata `json:"response_metadata,omitempty"`
 	UsageData  *UsageMetadata    `json:"usage_metadata,omitempty"`
+	// ToolMetadata is set on tool messages
+	ToolMetadata *ToolMetadata `json:"tool_metadata,omitempty"`
+}
+
+// ToolMetadata describes how the result of a tool message was obtained.
+type ToolMetadata struct {
+	CacheHit   bool  `json:"cache_hit"`
+	CacheAgeMs int64 `json:"cache_age_ms,omitempty"`
+}
+
+// UnmarshalJSON accepts content either as a string or as an array of
+// content parts, as sent in the request history.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type plain Message
+	var msg struct {
+		plain
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+
+	content, parts, err := parseContent(msg.Content)
+	if err != nil {
+		return err
+	}
+	*m = Message(msg.plain)
+	m.Content = content
+	if parts != nil {
+		m.Parts = parts
+	}
+	return nil
+}
+
+// AgentInput is the user turn handed to the agent: the text input, its
+// content parts and the earlier conversation.
+type AgentInput struct {
+	Text    string
+	Parts   []ContentPart
+	History []Message
 }
 
 type AgentState struct {
-	Input    string    `json:"input"`
-	Messages []Message `json:"messages"`
-	Message  *string   `json:"message,omitempty"`
+	Input      string        `json:"input"`
+	InputParts []ContentPart `json:"input_parts,omitempty"`
+	History    []Message     `json:"history,omitempty"`
+	Messages   []Message     `json:"messages"`
+	Message    *string       `json:"message,omitempty"`
 }
 
 type ChatResponse struct {
 	Messages         []Message         `json:"messages"` // ada
 	Message          string            `json:"message"`  // ada
+	Structured       any               `json:"structured,omitempty"`
 	Metadata         *ResponseMetadata `json:"metadata,omitempty"`
 	UsageMetadata    *UsageMetadata    `json:"usage_metadata,omitempty"`
+	Cost             *Cost             `json:"cost,omitempty"`
 	ModelProvider    string            `json:"model_provider,omitempty"` // ada
 	ModelName        string            `json:"model_name,omitempty"`     // ada
 	FinishReason     string            `json:"finish_reason,omitempty"`
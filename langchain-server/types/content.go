@@ -0,0 +1,134 @@
+package types
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	ContentText     = "text"
+	ContentImageURL = "image_url"
+	ContentImage    = "image"
+	ContentFile     = "file"
+	// Only produced for tool results
+	ContentResourceLink = "resource_link"
+)
+
+// ContentPart is one piece of a multimodal message:
+//
+//	{"type": "text", "text": "What is wrong on this page?"}
+//	{"type": "image_url", "image_url": "https://example.com/screenshot.png"}
+//	{"type": "image", "data": "<base64>", "mime_type": "image/png"}
+//	{"type": "file", "data": "<base64>", "mime_type": "text/plain", "name": "app.log"}
+type ContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
+	Name     string `json:"name,omitempty"`
+	URI      string `json:"uri,omitempty"`
+}
+
+// IsImage reports whether the part needs a vision-capable model.
+func (p ContentPart) IsImage() bool {
+	return p.Type == ContentImageURL || p.Type == ContentImage
+}
+
+// Decode returns the base64 payload of an image or file part.
+func (p ContentPart) Decode() ([]byte, error) {
+	data := p.Data
+	// Accept data URLs as well as bare base64
+	if strings.HasPrefix(data, "data:") {
+		if idx := strings.Index(data, ","); idx >= 0 {
+			data = data[idx+1:]
+		}
+	}
+	return base64.StdEncoding.DecodeString(data)
+}
+
+// Validate checks the part is complete and its payload decodes.
+func (p ContentPart) Validate() error {
+	switch p.Type {
+	case ContentText:
+		return nil
+	case ContentImageURL:
+		if p.ImageURL == "" {
+			return fmt.Errorf("image_url part is missing image_url")
+		}
+		return nil
+	case ContentImage:
+		if !strings.HasPrefix(p.MimeType, "image/") {
+			return fmt.Errorf("image part needs an image/* mime_type")
+		}
+	case ContentFile:
+		if !IsTextMimeType(p.MimeType) {
+			return fmt.Errorf("unsupported file type %q, only text files can be attached", p.MimeType)
+		}
+	default:
+		return fmt.Errorf("unknown content part type %q", p.Type)
+	}
+
+	if p.Data == "" {
+		return fmt.Errorf("%s part is missing data", p.Type)
+	}
+	if _, err := p.Decode(); err != nil {
+		return fmt.Errorf("%s part has invalid base64 data", p.Type)
+	}
+	return nil
+}
+
+// IsTextMimeType reports whether a file can be inlined into the prompt.
+func IsTextMimeType(mimeType string) bool {
+	mimeType = strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0])
+	if strings.HasPrefix(mimeType, "text/") {
+		return true
+	}
+	switch mimeType {
+	case "application/json", "application/xml", "application/yaml", "application/x-yaml", "application/csv":
+		return true
+	}
+	return false
+}
+
+// PartsText joins the text parts, used wherever a plain string is needed.
+func PartsText(parts []ContentPart) string {
+	var texts []string
+	for _, part := range parts {
+		if part.Type == ContentText && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// HasImages reports whether any part is an image.
+func HasImages(parts []ContentPart) bool {
+	for _, part := range parts {
+		if part.IsImage() {
+			return true
+		}
+	}
+	return false
+}
+
+// parseContent decodes a content field that is either a string or an array
+// of content parts.
+func parseContent(raw json.RawMessage) (string, []ContentPart, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil, nil
+	}
+
+	var parts []ContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", nil, fmt.Errorf("content must be a string or an array of content parts")
+	}
+	return PartsText(parts), parts, nil
+}
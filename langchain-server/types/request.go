@@ -1,10 +1,63 @@
 package types
 
+import "encoding/json"
+
 type RequestChatBody struct {
 	Credential   RequestChatCredential `json:"credential"`
 	SystemPrompt *string               `json:"system_prompt,omitempty"`
 	Input        string                `json:"input"`
-	Servers      []string              `json:"servers"`
+	// InputParts holds the content parts when input is sent as an array;
+	// Input then carries their joined text
+	InputParts []ContentPart `json:"-"`
+	// History holds earlier conversation turns, oldest first
+	History []Message   `json:"history,omitempty"`
+	Servers []MCPServer `json:"servers"`
+	// Tools filters the tools of every server; servers may add their own filter
+	Tools *ToolFilter `json:"tools,omitempty"`
+	// ToolRetrieval limits the offered tools to the most relevant ones
+	ToolRetrieval *ToolRetrieval `json:"tool_retrieval,omitempty"`
+	// Resources are read from their servers and attached to the input
+	Resources []ResourceRef `json:"resources,omitempty"`
+	// Prompt expands a server prompt template into the conversation
+	Prompt *PromptRef `json:"prompt,omitempty"`
+	// ResponseFormat asks for a final answer that validates against a JSON Schema
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+// UnmarshalJSON accepts input either as a string or as an array of content
+// parts.
+func (b *RequestChatBody) UnmarshalJSON(data []byte) error {
+	type plain RequestChatBody
+	var body struct {
+		plain
+		Input json.RawMessage `json:"input"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return err
+	}
+
+	input, parts, err := parseContent(body.Input)
+	if err != nil {
+		return err
+	}
+	*b = RequestChatBody(body.plain)
+	b.Input = input
+	b.InputParts = parts
+	return nil
+}
+
+// AgentInput returns the user turn handed to the agent.
+func (b *RequestChatBody) AgentInput() AgentInput {
+	return AgentInput{
+		Text:    b.Input,
+		Parts:   b.InputParts,
+		History: b.History,
+	}
+}
+
+type ResponseFormat struct {
+	Name   string         `json:"name,omitempty"`
+	Schema map[string]any `json:"schema"`
 }
 
 type RequestChatCredential struct {
@@ -12,7 +65,16 @@ type RequestChatCredential struct {
 	Model    *string `json:"model,omitempty"`
 	URL      *string `json:"url,omitempty"`
 	APIKey   *string `json:"api_key,omitempty"`
-	Set      *SetLLM `json:"set,omitempty"`
+	Project  *string `json:"project,omitempty"`  // Vertex AI project
+	Location *string `json:"location,omitempty"` // Vertex AI location
+	// Azure OpenAI deployment and API version
+	Deployment *string `json:"deployment,omitempty"`
+	APIVersion *string `json:"api_version,omitempty"`
+	// Extra headers sent with every LLM request (azure_openai, openai_compatible)
+	Headers map[string]string `json:"headers,omitempty"`
+	Set     *SetLLM           `json:"set,omitempty"`
+	// Fallbacks are tried in order when this provider fails
+	Fallbacks []RequestChatCredential `json:"fallbacks,omitempty"`
 }
 
 type SetLLM struct {
@@ -22,9 +84,10 @@ type SetLLM struct {
 	FrequencyPenalty   *float64 `json:"frequency_penalty,omitempty"`
 	PresencePenalty    *float64 `json:"presence_penalty,omitempty"`
 	Stop               []string `json:"stop,omitempty"`
-	Timeout            *int     `json:"timeout,omitempty"`
-	MaxRetries         *int     `json:"max_retries,omitempty"`
+	Timeout            *int     `json:"timeout,omitempty"`              // Per-attempt timeout in seconds
+	MaxRetries         *int     `json:"max_retries,omitempty"`          // Retries on 429/5xx/timeouts (default 2)
 	MaxContextMessages *int     `json:"max_context_messages,omitempty"` // Limit message history to prevent context overflow
+	ToolCalling        *string  `json:"tool_calling,omitempty"`         // auto (default), native or manual
 }
 
 type LLMPublicProvider string
@@ -33,6 +96,9 @@ const (
 	ProviderOpenAI     LLMPublicProvider = "openai"
 	ProviderClaude     LLMPublicProvider = "claude"
 	ProviderOpenRouter LLMPublicProvider = "openrouter"
+	ProviderGemini     LLMPublicProvider = "gemini"
+	ProviderVertex     LLMPublicProvider = "vertex"
+	ProviderAzure      LLMPublicProvider = "azure_openai"
 )
 
 type LLMLocalProvider string
@@ -41,4 +107,6 @@ const (
 	ProviderOllama   LLMLocalProvider = "ollama"
 	ProviderLlamaCPP LLMLocalProvider = "llama_cpp"
 	ProviderVLLM     LLMLocalProvider = "vllm"
+	// Any server speaking the OpenAI API (LiteLLM, Groq, Together, LM Studio, ...)
+	ProviderOpenAICompatible LLMLocalProvider = "openai_compatible"
 )
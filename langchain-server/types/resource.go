@@ -0,0 +1,65 @@
+package types
+
+// ResourceRef attaches an MCP resource to a chat request. Server is the url
+// of one of the request's servers.
+type ResourceRef struct {
+	Server string `json:"server"`
+	URI    string `json:"uri"`
+}
+
+// PromptRef starts a chat request from a prompt template of one of the
+// request's servers.
+type PromptRef struct {
+	Server    string            `json:"server"`
+	Name      string            `json:"name"`
+	Arguments map[string]string `json:"arguments,omitempty"`
+}
+
+// Resource is an entry of an MCP server's resources/list.
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceContents is one item returned by resources/read. Text resources
+// carry Text, binary ones base64 Blob.
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// Prompt is an entry of an MCP server's prompts/list.
+type Prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// PromptMessage is one message returned by prompts/get. Content is a single
+// item: text, image, or an embedded resource.
+type PromptMessage struct {
+	Role    string `json:"role"`
+	Content struct {
+		ToolContent
+		Resource *ResourceContents `json:"resource,omitempty"`
+	} `json:"content"`
+}
+
+// ServerCatalog lists what an MCP server offers besides tools.
+type ServerCatalog struct {
+	URL       string     `json:"url,omitempty"`
+	Alias     string     `json:"alias,omitempty"`
+	Resources []Resource `json:"resources"`
+	Prompts   []Prompt   `json:"prompts"`
+	Error     string     `json:"error,omitempty"`
+}
@@ -0,0 +1,213 @@
+package types
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Transports for talking to MCP servers. rest is the project's own
+// /mcp/tools and /mcp/invoke protocol, mcp-http the standard MCP JSON-RPC
+// Streamable HTTP transport and stdio a subprocess declared in the server's
+// stdio config, addressed as stdio://<alias>.
+const (
+	TransportREST    = "rest"
+	TransportMCPHTTP = "mcp-http"
+	TransportStdio   = "stdio"
+
+	stdioScheme = "stdio://"
+)
+
+// MCPServer is one entry of the request's "servers" list. It accepts either a
+// plain URL string or an object with per-server settings.
+type MCPServer struct {
+	URL string `json:"url,omitempty"`
+	// Alias and Tag reference servers of the gateway registry instead of a
+	// URL; Alias is also the name of a registered server
+	Alias          string         `json:"alias,omitempty"`
+	Tag            string         `json:"tag,omitempty"`
+	Transport      string         `json:"transport,omitempty"`         // rest (default), mcp-http or stdio
+	TimeoutMs      *int           `json:"timeout_ms,omitempty"`        // Default timeout for calls to this server
+	ToolTimeoutsMs map[string]int `json:"tool_timeouts_ms,omitempty"`  // Per-tool invocation timeouts
+	ToolCacheTTLMs map[string]int `json:"tool_cache_ttl_ms,omitempty"` // Per-tool result cache TTLs, overriding the tool definition
+	Tools          *ToolFilter    `json:"tools,omitempty"`             // Tools of this server offered to the model
+	// Authentication for HTTP transports
+	Headers        map[string]string `json:"headers,omitempty"`          // Sent with every call
+	BearerTokenRef string            `json:"bearer_token_ref,omitempty"` // Server-side secret sent as a bearer token
+	OAuth          *MCPOAuth         `json:"oauth,omitempty"`            // OAuth2 client credentials grant
+	// Registered marks a server taken from the gateway registry. Only the
+	// gateway sets it, so its URL is never shown to clients.
+	Registered bool `json:"-"`
+}
+
+// RegisteredServer is an entry of the gateway's server registry.
+type RegisteredServer struct {
+	MCPServer
+	Tags []string `json:"tags,omitempty"`
+}
+
+func (r *RegisteredServer) UnmarshalJSON(data []byte) error {
+	var tags struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return err
+	}
+	var server MCPServer
+	if err := json.Unmarshal(data, &server); err != nil {
+		return err
+	}
+	*r = RegisteredServer{MCPServer: server, Tags: tags.Tags}
+	return nil
+}
+
+// HasTag reports whether the entry carries tag.
+func (r RegisteredServer) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// MCPOAuth obtains access tokens with the OAuth2 client credentials grant.
+// The client secret is given either inline or as a server-side secret name.
+type MCPOAuth struct {
+	TokenURL        string   `json:"token_url"`
+	ClientID        string   `json:"client_id"`
+	ClientSecret    string   `json:"client_secret,omitempty"`
+	ClientSecretRef string   `json:"client_secret_ref,omitempty"`
+	Scopes          []string `json:"scopes,omitempty"`
+}
+
+// HasAuth reports whether any authentication is configured.
+func (s MCPServer) HasAuth() bool {
+	return len(s.Headers) > 0 || s.BearerTokenRef != "" || s.OAuth != nil
+}
+
+// UnmarshalJSON accepts a URL string, the alias of a registered server (a
+// string without a scheme) or an object.
+func (s *MCPServer) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		if strings.Contains(url, "://") {
+			*s = MCPServer{URL: url}
+		} else {
+			*s = MCPServer{Alias: url}
+		}
+	} else {
+		type plain MCPServer
+		var server plain
+		if err := json.Unmarshal(data, &server); err != nil {
+			return err
+		}
+		*s = MCPServer(server)
+	}
+
+	if s.Transport == "" && strings.HasPrefix(s.URL, stdioScheme) {
+		s.Transport = TransportStdio
+	}
+	return nil
+}
+
+// Name identifies the server to clients: the alias of a registered server,
+// otherwise its URL.
+func (s MCPServer) Name() string {
+	if s.Registered {
+		return s.Alias
+	}
+	return s.URL
+}
+
+// PublicURL returns the URL to show to clients, which is empty for
+// registered servers.
+func (s MCPServer) PublicURL() string {
+	if s.Registered {
+		return ""
+	}
+	return s.URL
+}
+
+// StdioAlias returns the configured stdio server a stdio:// URL refers to.
+func (s MCPServer) StdioAlias() string {
+	return strings.TrimPrefix(s.URL, stdioScheme)
+}
+
+// Timeout returns the server's configured timeout, or fallback when unset.
+func (s MCPServer) Timeout(fallback time.Duration) time.Duration {
+	if s.TimeoutMs != nil && *s.TimeoutMs > 0 {
+		return time.Duration(*s.TimeoutMs) * time.Millisecond
+	}
+	return fallback
+}
+
+// ToolTimeout returns the timeout for invoking toolName on this server.
+func (s MCPServer) ToolTimeout(toolName string, fallback time.Duration) time.Duration {
+	if ms, ok := s.ToolTimeoutsMs[toolName]; ok && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return s.Timeout(fallback)
+}
+
+// ToolCacheTTL returns how long results of tool may be reused. The server's
+// setting wins over the tool definition; 0 means the tool is not cacheable.
+func (s MCPServer) ToolCacheTTL(tool Tool) time.Duration {
+	ms := tool.CacheTTLMs
+	if override, ok := s.ToolCacheTTLMs[tool.Name]; ok {
+		ms = override
+	}
+	if ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// ServerStatus reports the health check and tool discovery of one server.
+type ServerStatus struct {
+	URL       string `json:"url,omitempty"`
+	Alias     string `json:"alias,omitempty"`
+	Available bool   `json:"available"`
+	Cached    bool   `json:"cached,omitempty"` // Tools served from the catalog cache
+	LatencyMs int64  `json:"latency_ms"`
+	ToolCount int    `json:"tool_count"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Circuit breaker states of a server.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// ServerHealth is the call history of a server the gateway has talked to.
+// Latencies are percentiles of its recent calls.
+type ServerHealth struct {
+	URL                 string     `json:"url,omitempty"`
+	Alias               string     `json:"alias,omitempty"`
+	Tags                []string   `json:"tags,omitempty"`
+	Transport           string     `json:"transport"`
+	Authenticated       bool       `json:"authenticated,omitempty"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Calls               int64      `json:"calls"`
+	Failures            int64      `json:"failures"`
+	SlowCalls           int64      `json:"slow_calls"`
+	Rejected            int64      `json:"rejected"`
+	LatencyP50Ms        int64      `json:"latency_p50_ms"`
+	LatencyP90Ms        int64      `json:"latency_p90_ms"`
+	LatencyP99Ms        int64      `json:"latency_p99_ms"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time `json:"last_error_at,omitempty"`
+	OpenUntil           *time.Time `json:"open_until,omitempty"`
+}
+
+// ServerNames lists the names of the given servers, see MCPServer.Name.
+func ServerNames(servers []MCPServer) []string {
+	names := make([]string, 0, len(servers))
+	for _, server := range servers {
+		names = append(names, server.Name())
+	}
+	return names
+}
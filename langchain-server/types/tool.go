@@ -1,9 +1,18 @@
 package types
 
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+)
+
 type Tool struct {
 	Name        string        `json:"name"`
 	Description string        `json:"description"`
 	Parameters  ToolParameter `json:"parameters"`
+	// CacheTTLMs marks a deterministic tool whose results may be reused for
+	// identical arguments for this long
+	CacheTTLMs int `json:"cache_ttl_ms,omitempty"`
 }
 
 type ParameterType string
@@ -27,6 +36,72 @@ type ToolParameterProperty struct {
 	Enum        []interface{} `json:"enum,omitempty"`
 }
 
+// ToolFilter narrows the tools offered to the model with glob patterns
+// (path.Match syntax) on tool names. A tool is offered when it matches an
+// include pattern, or there are none, and matches no exclude pattern.
+type ToolFilter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	// and is a filter the tool must pass as well, set by Intersect
+	and *ToolFilter
+}
+
+// Allows reports whether the filter offers the tool. A nil filter allows
+// every tool.
+func (f *ToolFilter) Allows(name string) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Include) > 0 && !matchAny(f.Include, name) {
+		return false
+	}
+	return !matchAny(f.Exclude, name) && f.and.Allows(name)
+}
+
+// Intersect returns a filter offering only the tools both filters offer.
+// Either may be nil.
+func (f *ToolFilter) Intersect(other *ToolFilter) *ToolFilter {
+	if f == nil {
+		return other
+	}
+	if other == nil {
+		return f
+	}
+	both := *f
+	both.and = f.and.Intersect(other)
+	return &both
+}
+
+// Validate checks every pattern is well formed.
+func (f *ToolFilter) Validate() error {
+	if f == nil {
+		return nil
+	}
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid tool pattern %q", pattern)
+		}
+	}
+	return f.and.Validate()
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ToolRetrieval offers only the TopK tools most relevant to the input
+// instead of every tool. Method is auto (default: embeddings when an
+// embedder is configured, else BM25), embedding or bm25.
+type ToolRetrieval struct {
+	TopK   int    `json:"top_k"`
+	Method string `json:"method,omitempty"`
+}
+
 type ToolInvokeRequest struct {
 	Name      string                 `json:"name"`
 	Arguments map[string]interface{} `json:"arguments"`
@@ -35,3 +110,65 @@ type ToolInvokeRequest struct {
 type ToolInvokeResponse struct {
 	Result interface{} `json:"result"`
 }
+
+const (
+	ToolContentText         = "text"
+	ToolContentImage        = "image"
+	ToolContentResourceLink = "resource_link"
+)
+
+// ToolResult is the typed result envelope a tool may return instead of plain
+// JSON. Field names follow the MCP specification:
+//
+//	{"content": [{"type": "text", "text": "..."},
+//	             {"type": "image", "data": "<base64>", "mimeType": "image/png"},
+//	             {"type": "resource_link", "uri": "https://...", "name": "report.pdf"}],
+//	 "isError": false}
+type ToolResult struct {
+	Content []ToolContent `json:"content"`
+	IsError bool          `json:"isError,omitempty"`
+}
+
+type ToolContent struct {
+	Type        string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	Data        string `json:"data,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+	URI         string `json:"uri,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// AsToolResult returns the envelope when a decoded tool result is one: an
+// object with a "content" array whose items all have a known type.
+func AsToolResult(result interface{}) (*ToolResult, bool) {
+	obj, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	items, ok := obj["content"].([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, false
+	}
+	for _, item := range items {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		switch itemMap["type"] {
+		case ToolContentText, ToolContentImage, ToolContentResourceLink:
+		default:
+			return nil, false
+		}
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, false
+	}
+	var toolResult ToolResult
+	if err := json.Unmarshal(data, &toolResult); err != nil {
+		return nil, false
+	}
+	return &toolResult, true
+}
@@ -0,0 +1,107 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileLedger appends records as JSON lines to a local file.
+type FileLedger struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileLedger(path string) *FileLedger {
+	return &FileLedger{path: path}
+}
+
+func (l *FileLedger) Append(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if dir := filepath.Dir(l.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// maxRecordLine bounds a single ledger line; longer lines are skipped.
+const maxRecordLine = 1024 * 1024
+
+// Query scans the ledger without holding the lock, so appends are not
+// blocked behind it. The lock is only taken to snapshot the file size:
+// every append writes a whole line under the lock, so the snapshot ends on
+// a line boundary and anything appended later is left for the next query.
+func (l *FileLedger) Query(filter Filter) ([]Record, error) {
+	l.mu.Lock()
+	f, err := os.Open(l.path)
+	if err != nil {
+		l.mu.Unlock()
+		if os.IsNotExist(err) {
+			return []Record{}, nil
+		}
+		return nil, err
+	}
+	info, err := f.Stat()
+	l.mu.Unlock()
+	defer f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	records := []Record{}
+	reader := bufio.NewReaderSize(io.LimitReader(f, info.Size()), 64*1024)
+	var line []byte
+	oversized := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Keep reading up to the newline, dropping the line once it
+			// grows past maxRecordLine
+			if !oversized && len(line)+len(chunk) <= maxRecordLine {
+				line = append(line, chunk...)
+			} else {
+				oversized, line = true, line[:0]
+			}
+			continue
+		}
+		if err == io.EOF {
+			// A trailing line without a newline is not a complete record
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if !oversized && len(line)+len(chunk) <= maxRecordLine {
+			line = append(line, chunk...)
+			var record Record
+			// Skip corrupt lines
+			if json.Unmarshal(line, &record) == nil && filter.Match(record) {
+				records = append(records, record)
+			}
+		}
+		oversized, line = false, line[:0]
+	}
+
+	return records, nil
+}
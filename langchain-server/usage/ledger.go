@@ -0,0 +1,103 @@
+package usage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"langchain-mcp-api/env"
+	"langchain-mcp-api/types"
+	"langchain-mcp-api/utils"
+)
+
+// Record is one ledger line describing a single chat request.
+type Record struct {
+	RequestID       string    `json:"request_id"`
+	Timestamp       time.Time `json:"timestamp"`
+	Endpoint        string    `json:"endpoint"`
+	APIKey          string    `json:"api_key,omitempty"`
+	SessionID       string    `json:"session_id,omitempty"`
+	Provider        string    `json:"provider"`
+	Model           string    `json:"model"`
+	Status          string    `json:"status"`
+	Error           string    `json:"error,omitempty"`
+	InputTokens     int       `json:"input_tokens"`
+	OutputTokens    int       `json:"output_tokens"`
+	TotalTokens     int       `json:"total_tokens"`
+	CachedTokens    int       `json:"cached_tokens,omitempty"`
+	ReasoningTokens int       `json:"reasoning_tokens,omitempty"`
+	Iterations      int       `json:"iterations"`
+	ToolCalls       int       `json:"tool_calls"`
+	LatencyMs       int64     `json:"latency_ms"`
+	Cost            float64   `json:"cost,omitempty"`
+}
+
+const (
+	StatusSuccess = "success"
+	StatusError   = "error"
+)
+
+// Ledger stores usage records and answers queries over them.
+type Ledger interface {
+	Append(record Record) error
+	Query(filter Filter) ([]Record, error)
+}
+
+var defaultLedger Ledger
+
+func init() {
+	if strings.EqualFold(env.UsageLedgerPath, "off") {
+		return
+	}
+	defaultLedger = NewFileLedger(env.UsageLedgerPath)
+}
+
+// Default returns the process-wide ledger, or nil when it is disabled.
+func Default() Ledger {
+	return defaultLedger
+}
+
+// Append writes a record to the default ledger. Failures are only logged so
+// that accounting never breaks a chat response.
+func Append(record Record) {
+	if defaultLedger == nil {
+		return
+	}
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now().UTC()
+	}
+	if err := defaultLedger.Append(record); err != nil {
+		utils.VerbosePrintf("[%s] ❌ [USAGE] Failed to write ledger record: %v\n", record.RequestID, err)
+	}
+}
+
+// KeyFingerprint turns an API key into a stable identifier that is safe to
+// persist and to group by.
+func KeyFingerprint(apiKey string) string {
+	if apiKey == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return "key_" + hex.EncodeToString(sum[:])[:16]
+}
+
+// SetUsage copies the aggregated token counters of a request into the record.
+func (r *Record) SetUsage(u *types.UsageMetadata) {
+	if u == nil {
+		return
+	}
+	r.InputTokens = u.InputTokens
+	r.OutputTokens = u.OutputTokens
+	r.TotalTokens = u.TotalTokens
+	r.CachedTokens = u.PromptCachedTokens
+	r.ReasoningTokens = u.CompletionReasoningTokens + u.ReasoningTokens
+}
+
+// SetCost records the estimated USD cost of the request.
+func (r *Record) SetCost(c *types.Cost) {
+	if c == nil {
+		return
+	}
+	r.Cost = c.TotalCost
+}
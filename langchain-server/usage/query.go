@@ -0,0 +1,121 @@
+package usage
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Filter selects ledger records. Zero values match everything.
+type Filter struct {
+	From      time.Time
+	To        time.Time
+	Provider  string
+	Model     string
+	APIKey    string
+	SessionID string
+	Status    string
+}
+
+func (f Filter) Match(r Record) bool {
+	if !f.From.IsZero() && r.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !r.Timestamp.Before(f.To) {
+		return false
+	}
+	if f.Provider != "" && r.Provider != f.Provider {
+		return false
+	}
+	if f.Model != "" && r.Model != f.Model {
+		return false
+	}
+	if f.APIKey != "" && r.APIKey != f.APIKey {
+		return false
+	}
+	if f.SessionID != "" && r.SessionID != f.SessionID {
+		return false
+	}
+	if f.Status != "" && r.Status != f.Status {
+		return false
+	}
+	return true
+}
+
+// Totals is the aggregate of a set of records.
+type Totals struct {
+	Group           string  `json:"group,omitempty"`
+	Requests        int     `json:"requests"`
+	Errors          int     `json:"errors"`
+	InputTokens     int     `json:"input_tokens"`
+	OutputTokens    int     `json:"output_tokens"`
+	TotalTokens     int     `json:"total_tokens"`
+	CachedTokens    int     `json:"cached_tokens"`
+	ReasoningTokens int     `json:"reasoning_tokens"`
+	ToolCalls       int     `json:"tool_calls"`
+	LatencyMs       int64   `json:"latency_ms"`
+	AvgLatencyMs    int64   `json:"avg_latency_ms"`
+	Cost            float64 `json:"cost"`
+}
+
+func (t *Totals) add(r Record) {
+	t.Requests++
+	if r.Status == StatusError {
+		t.Errors++
+	}
+	t.InputTokens += r.InputTokens
+	t.OutputTokens += r.OutputTokens
+	t.TotalTokens += r.TotalTokens
+	t.CachedTokens += r.CachedTokens
+	t.ReasoningTokens += r.ReasoningTokens
+	t.ToolCalls += r.ToolCalls
+	t.LatencyMs += r.LatencyMs
+	t.Cost = math.Round((t.Cost+r.Cost)*1e8) / 1e8
+	t.AvgLatencyMs = t.LatencyMs / int64(t.Requests)
+}
+
+var groupKeys = map[string]func(Record) string{
+	"day":      func(r Record) string { return r.Timestamp.UTC().Format("2006-01-02") },
+	"model":    func(r Record) string { return r.Provider + "/" + r.Model },
+	"provider": func(r Record) string { return r.Provider },
+	"key":      func(r Record) string { return r.APIKey },
+	"session":  func(r Record) string { return r.SessionID },
+}
+
+// Sum aggregates all records into a single total.
+func Sum(records []Record) Totals {
+	var totals Totals
+	for _, r := range records {
+		totals.add(r)
+	}
+	return totals
+}
+
+// Group aggregates records per day, model, provider, key or session, sorted
+// by group name.
+func Group(records []Record, by string) ([]Totals, error) {
+	keyFn, ok := groupKeys[by]
+	if !ok {
+		return nil, fmt.Errorf("unsupported group_by: %s", by)
+	}
+
+	groups := map[string]*Totals{}
+	for _, r := range records {
+		key := keyFn(r)
+		if groups[key] == nil {
+			groups[key] = &Totals{Group: key}
+		}
+		groups[key].add(r)
+	}
+
+	result := make([]Totals, 0, len(groups))
+	for _, t := range groups {
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Group < result[j].Group
+	})
+
+	return result, nil
+}
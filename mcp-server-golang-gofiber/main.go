@@ -7,6 +7,7 @@ import (
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/cors"
+	"github.com/gofiber/fiber/v3/middleware/etag"
 	"github.com/gofiber/fiber/v3/middleware/helmet"
 	"github.com/gofiber/fiber/v3/middleware/logger"
 )
@@ -26,13 +27,15 @@ func main() {
 		return c.JSON(fiber.Map{"status": "ok"})
 	})
 
-	app.Get("/mcp/tools", func(c fiber.Ctx) error {
+	// ETag lets clients that cache the tool list revalidate it cheaply
+	app.Get("/mcp/tools", etag.New(), func(c fiber.Ctx) error {
 		toolsResponse := make([]types.ToolResponse, len(registry.Tools))
 		for i, tool := range registry.Tools {
 			toolsResponse[i] = types.ToolResponse{
 				Name:        tool.Name,
 				Description: tool.Description,
 				Parameters:  tool.Parameters,
+				CacheTTLMs:  tool.CacheTTLMs,
 			}
 		}
 		return c.JSON(toolsResponse)
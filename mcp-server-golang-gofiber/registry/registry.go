@@ -12,6 +12,7 @@ func init() {
 	Tools = append(Tools, tools.GetDatetimeTools()...)
 	Tools = append(Tools, tools.GetConverterTools()...)
 	Tools = append(Tools, tools.GetRandomTools()...)
+	Tools = append(Tools, tools.GetImageTools()...)
 }
 
 func FindTool(name string) *types.Tool {
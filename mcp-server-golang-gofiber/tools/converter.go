@@ -5,10 +5,14 @@ import (
 	"mcp-server/types"
 )
 
+// Conversions are deterministic, so clients may cache their results
+const conversionCacheTTLMs = 60 * 60 * 1000
+
 func GetConverterTools() []types.Tool {
 	return []types.Tool{
 		{
 			Name:        "celsius_to_fahrenheit",
+			CacheTTLMs:  conversionCacheTTLMs,
 			Description: "Mengkonversi suhu dari Celsius ke Fahrenheit",
 			Parameters: map[string]interface{}{
 				"type": "object",
@@ -36,6 +40,7 @@ func GetConverterTools() []types.Tool {
 		},
 		{
 			Name:        "fahrenheit_to_celsius",
+			CacheTTLMs:  conversionCacheTTLMs,
 			Description: "Mengkonversi suhu dari Fahrenheit ke Celsius",
 			Parameters: map[string]interface{}{
 				"type": "object",
@@ -63,6 +68,7 @@ func GetConverterTools() []types.Tool {
 		},
 		{
 			Name:        "km_to_miles",
+			CacheTTLMs:  conversionCacheTTLMs,
 			Description: "Mengkonversi jarak dari kilometer ke mil",
 			Parameters: map[string]interface{}{
 				"type": "object",
@@ -92,6 +98,7 @@ func GetConverterTools() []types.Tool {
 		},
 		{
 			Name:        "miles_to_km",
+			CacheTTLMs:  conversionCacheTTLMs,
 			Description: "Mengkonversi jarak dari mil ke kilometer",
 			Parameters: map[string]interface{}{
 				"type": "object",
@@ -121,6 +128,7 @@ func GetConverterTools() []types.Tool {
 		},
 		{
 			Name:        "kg_to_pounds",
+			CacheTTLMs:  conversionCacheTTLMs,
 			Description: "Mengkonversi berat dari kilogram ke pound",
 			Parameters: map[string]interface{}{
 				"type": "object",
@@ -150,6 +158,7 @@ func GetConverterTools() []types.Tool {
 		},
 		{
 			Name:        "pounds_to_kg",
+			CacheTTLMs:  conversionCacheTTLMs,
 			Description: "Mengkonversi berat dari pound ke kilogram",
 			Parameters: map[string]interface{}{
 				"type": "object",
@@ -0,0 +1,70 @@
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"mcp-server/types"
+	"strconv"
+	"strings"
+)
+
+func GetImageTools() []types.Tool {
+	return []types.Tool{
+		{
+			Name:        "color_swatch",
+			Description: "Membuat gambar PNG berisi contoh warna dari kode hex",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"hex": map[string]interface{}{
+						"type":        "string",
+						"description": "Kode warna hex, contoh: #ff8800",
+					},
+					"size": map[string]interface{}{
+						"type":        "number",
+						"description": "Ukuran sisi gambar dalam pixel (default 64, maksimal 512)",
+					},
+				},
+				"required": []string{"hex"},
+			},
+			Handler: func(args map[string]interface{}) (interface{}, error) {
+				hex, _ := args["hex"].(string)
+				rgb, err := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+				if err != nil || len(strings.TrimPrefix(hex, "#")) != 6 {
+					return types.ToolResult{
+						Content: []types.ToolContent{types.TextContent(fmt.Sprintf("Kode hex tidak valid: %s", hex))},
+						IsError: true,
+					}, nil
+				}
+
+				size := 64
+				if s, ok := args["size"].(float64); ok && s > 0 {
+					size = min(int(s), 512)
+				}
+
+				fill := color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 255}
+				img := image.NewRGBA(image.Rect(0, 0, size, size))
+				for y := 0; y < size; y++ {
+					for x := 0; x < size; x++ {
+						img.Set(x, y, fill)
+					}
+				}
+
+				var buf bytes.Buffer
+				if err := png.Encode(&buf, img); err != nil {
+					return nil, err
+				}
+
+				return types.ToolResult{
+					Content: []types.ToolContent{
+						types.TextContent(fmt.Sprintf("Swatch %dx%d untuk warna #%06x (rgb %d, %d, %d)", size, size, rgb, fill.R, fill.G, fill.B)),
+						types.ImageContent(buf.Bytes(), "image/png"),
+					},
+				}, nil
+			},
+		},
+	}
+}
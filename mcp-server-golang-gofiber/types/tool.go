@@ -1,14 +1,50 @@
 package types
 
+import "encoding/base64"
+
 type Tool struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	Parameters  map[string]interface{} `json:"parameters"`
-	Handler     func(map[string]interface{}) (interface{}, error)
+	// CacheTTLMs lets clients reuse results for identical arguments; only
+	// set it on deterministic tools
+	CacheTTLMs int
+	Handler    func(map[string]interface{}) (interface{}, error)
 }
 
 type ToolResponse struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	Parameters  map[string]interface{} `json:"parameters"`
+	CacheTTLMs  int                    `json:"cache_ttl_ms,omitempty"`
+}
+
+// ToolResult is the typed result envelope a handler can return instead of
+// plain JSON, following the MCP content types.
+type ToolResult struct {
+	Content []ToolContent `json:"content"`
+	IsError bool          `json:"isError,omitempty"`
+}
+
+type ToolContent struct {
+	Type        string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	Data        string `json:"data,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+	URI         string `json:"uri,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+func TextContent(text string) ToolContent {
+	return ToolContent{Type: "text", Text: text}
+}
+
+// ImageContent encodes raw image bytes as base64.
+func ImageContent(data []byte, mimeType string) ToolContent {
+	return ToolContent{Type: "image", Data: base64.StdEncoding.EncodeToString(data), MimeType: mimeType}
+}
+
+func ResourceLinkContent(uri, name, mimeType string) ToolContent {
+	return ToolContent{Type: "resource_link", URI: uri, Name: name, MimeType: mimeType}
 }